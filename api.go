@@ -97,22 +97,28 @@ type Tools struct {
 	SyncTime      bool   `vmx:"synctime,omitempty"`
 	UpgradePolicy string `vmx:"upgrade.policy,omitempty"`
 	RemindInstall bool   `vmx:"remindinstall,omitempty"`
+	// Maximum size, in bytes, of the data the guest can send to the host
+	SetInfoSizeLimit uint `vmx:"setinfo.sizelimit,omitempty"`
+	// Let the guest query host performance information
+	GuestlibEnableHostInfo bool `vmx:"guestlib.enablehostinfo,omitempty"`
 }
 
 type UUID struct {
 	Action string `vmx:"action,omitempty"`
-	// Autogenerated, do not change
-	Bios string `vmx:"bios,omitempty"`
-	// Autogenerated, do not change
-	Location string `vmx:"location,omitempty"`
+	// Autogenerated. Guests see it as their system UUID, so it must be
+	// changed, with NewVMwareUUID, when copying a VM.
+	Bios VMwareUUID `vmx:"bios,omitempty"`
+	// Autogenerated. VMware asks whether a VM was moved or copied when it
+	// no longer matches the location of the VM.
+	Location VMwareUUID `vmx:"location,omitempty"`
 }
 
 type RemoteDisplay struct {
 	VNCEnabled     bool   `vmx:"vnc.enabled,omitempty"`
 	VNCPort        uint   `vmx:"vnc.port,omitempty"`
-	VNCPassword    string `vmx:"vnc.password,omitempty"`
+	VNCPassword    string `vmx:"vnc.password,omitempty,secret"`
 	VNCIPAddress   string `vmx:"vnc.ip,omitempty"`
-	VNCKey         string `vmx:"vnc.key,omitempty"`
+	VNCKey         string `vmx:"vnc.key,omitempty,secret"`
 	VNCKeyMap      string `vmx:"vnc.keymap,omitempty"`
 	VNCKeyMapFile  string `vmx:"vnc.keymapfile,omitempty"`
 	VNCZlibLevel   uint   `vmx:"vnc.zliblevel,omitempty"`
@@ -121,6 +127,9 @@ type RemoteDisplay struct {
 	MaxConnections uint   `vmx:"maxconnections,omitempty"`
 	MaxHeight      uint   `vmx:"maxheight,omitempty"`
 	MaxWidth       uint   `vmx:"maxwidth,omitempty"`
+	// Never write vnc.password in plaintext, only vnc.key as set by a
+	// VMware product
+	VNCKeyOnly bool
 }
 
 type SharedFolder struct {
@@ -147,6 +156,47 @@ type Isolation struct {
 	CopyDisable      bool `vmx:"tools.copy.disable,omitempty"`
 	PasteDisable     bool `vmx:"tools.paste.disable,omitempty"`
 	DragNDropDisable bool `vmx:"tools.dnd.disable,omitempty"`
+	// Let the guest change the copy and paste settings
+	SetGUIOptionsEnable bool `vmx:"tools.setguioptions.enable,omitempty"`
+	DiskShrinkDisable   bool `vmx:"tools.diskshrink.disable,omitempty"`
+	DiskWiperDisable    bool `vmx:"tools.diskwiper.disable,omitempty"`
+	AutoInstallDisable  bool `vmx:"tools.autoinstall.disable,omitempty"`
+	VixMessageDisable   bool `vmx:"tools.vixmessage.disable,omitempty"`
+	GetCredsDisable     bool `vmx:"tools.getcreds.disable,omitempty"`
+	// Disable Unity and the guest host integration (GHI) features
+	UnityDisable              bool `vmx:"tools.unity.disable,omitempty"`
+	UnityInterlockDisable     bool `vmx:"tools.unityinterlockoperation.disable,omitempty"`
+	UnityPushUpdateDisable    bool `vmx:"tools.unity.push.update.disable,omitempty"`
+	UnityTaskbarDisable       bool `vmx:"tools.unity.taskbar.disable,omitempty"`
+	UnityWindowContDisable    bool `vmx:"tools.unity.windowcontents.disable,omitempty"`
+	UnityActiveDisable        bool `vmx:"tools.unityactive.disable,omitempty"`
+	GHIAutologonDisable       bool `vmx:"tools.ghi.autologon.disable,omitempty"`
+	GHILaunchMenuChange       bool `vmx:"tools.ghi.launchmenu.change,omitempty"`
+	GHIProtocolHandlerDisable bool `vmx:"tools.ghi.protocolhandler.info.disable,omitempty"`
+	GHITrayIconDisable        bool `vmx:"tools.ghi.trayicon.disable,omitempty"`
+	GHIShellActionDisable     bool `vmx:"ghi.host.shellaction.disable,omitempty"`
+	TrashFolderStateDisable   bool `vmx:"tools.trashfolderstate.disable,omitempty"`
+	DispTopoRequestDisable    bool `vmx:"tools.disptoporequest.disable,omitempty"`
+	MemSchedFakeStatsDisable  bool `vmx:"tools.memschedfakesamplestats.disable,omitempty"`
+	// Prevent the guest from connecting or modifying devices
+	DeviceConnectableDisable bool `vmx:"device.connectable.disable,omitempty"`
+	DeviceEditDisable        bool `vmx:"device.edit.disable,omitempty"`
+}
+
+// Encryption holds the settings of encrypted VMs. See ParseKeySafe and
+// DecryptData.
+type Encryption struct {
+	// Wrapped keys able to decrypt Data
+	KeySafe string `vmx:"keysafe,omitempty,secret"`
+	// Encrypted configuration, base64 encoded
+	Data string `vmx:"data,omitempty,secret"`
+}
+
+type Log struct {
+	// Number of old log files to keep
+	KeepOld uint `vmx:"keepold,omitempty"`
+	// Size, in bytes, at which the log is rotated
+	RotateSize uint `vmx:"rotatesize,omitempty"`
 }
 
 type FloppyDevice struct {
@@ -182,8 +232,46 @@ type RTC struct {
 }
 
 type BIOS struct {
+	// Comma separated devices to boot from, in order, such as
+	// hdd,cdrom,ethernet0. EFI firmware honors it too. See BootDevices.
 	BootOrder string `vmx:"bootorder,omitempty"`
 	HDDOrder  string `vmx:"hddorder,omitempty"`
+	// Milliseconds the firmware waits before booting
+	BootDelay uint `vmx:"bootdelay,omitempty"`
+	// Enter the firmware setup on the next boot. VMware resets it
+	// afterwards.
+	ForceSetupOnce bool `vmx:"forcesetuponce,omitempty"`
+}
+
+// Firmware types. VMware defaults to BIOS.
+const (
+	FIRMWARE_BIOS = "bios"
+	FIRMWARE_EFI  = "efi"
+)
+
+type VTPM struct {
+	// Requires EFI firmware and an encrypted VM. See EnableVTPM.
+	Present bool `vmx:"present,omitempty"`
+}
+
+// Value of managedVM.autoAddVTPM
+const AUTO_ADD_VTPM_SOFTWARE = "software"
+
+type ManagedVM struct {
+	// software to add a vTPM encrypting only the files it needs, instead
+	// of the whole VM, as Workstation does for Windows 11 guests
+	AutoAddVTPM string `vmx:"autoaddvtpm,omitempty"`
+}
+
+type Windows struct {
+	// Virtualization-based security. Requires EFI firmware, secure boot,
+	// nested virtualization and a virtual IOMMU.
+	VBSEnabled bool `vmx:"vbs.enabled,omitempty"`
+}
+
+type UEFI struct {
+	// Only boot signed bootloaders and kernels. Requires EFI firmware.
+	SecureBootEnabled bool `vmx:"secureboot.enabled,omitempty"`
 }
 
 type Config struct {
@@ -205,7 +293,7 @@ type VirtualMachine struct {
 	Autoanswer      bool      `vmx:"msg.autoanswer,omitempty"`
 	Sound           Sound     `vmx:"sound,omitempty"`
 	Tools           Tools     `vmx:"tools,omitempty"`
-	NVRam           string    `vmx:"nvmram,omitempty"`
+	NVRam           string    `vmx:"nvram,omitempty"`
 	UUID            UUID      `vmx:"uuid,omitempty"`
 	CleanShutdown   bool      `vmx:"cleanshutdown,omitempty"`
 	SoftPowerOff    bool      `vmx:"softpoweroff,omitempty"`
@@ -218,6 +306,16 @@ type VirtualMachine struct {
 	VHVEnable     bool           `vmx:"vhv.enable,omitempty"`
 	RemoteDisplay RemoteDisplay  `vmx:"remotedisplay,omitempty"`
 	Isolation     Isolation      `vmx:"isolation,omitempty"`
+	Log           Log            `vmx:"log,omitempty"`
+	Encryption    Encryption     `vmx:"encryption,omitempty"`
+	GuestInfo     GuestInfo      `vmx:"guestinfo,omitempty,secret"`
+	Firmware      string         `vmx:"firmware,omitempty"`
+	BIOS          BIOS           `vmx:"bios,omitempty"`
+	UEFI          UEFI           `vmx:"uefi,omitempty"`
+	VTPM          VTPM           `vmx:"vtpm,omitempty"`
+	ManagedVM     ManagedVM      `vmx:"managedvm,omitempty"`
+	VVTDEnable    bool           `vmx:"vvtd.enable,omitempty"`
+	Windows       Windows        `vmx:"windows,omitempty"`
 	SharedFolders []SharedFolder `vmx:"sharedfolder,omitempty"`
 	PCIBridges    []PCIBridge    `vmx:"pcibridge,omitempty"`
 	SerialPorts   []SerialPort   `vmx:"serial,omitempty"`
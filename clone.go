@@ -0,0 +1,259 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Keys tying a VM to its runtime state or to the host running it, which a
+// clone must not inherit.
+var cloneRemovedKeys = []string{
+	"vc.uuid",
+	"vmci0.id",
+	"checkpoint.vmState",
+	"sched.swap.derivedName",
+	"migrate.hostLog",
+}
+
+// Addresses VMware generated for the adapters of the source VM.
+var generatedAddressRe = regexp.MustCompile(`(?i)^ethernet\d+\.generatedAddress(Offset)?$`)
+
+// CloneOptions customizes Clone.
+type CloneOptions struct {
+	// Name of the clone, used as its display name and to name its NVRAM
+	// and extended configuration files
+	Name string
+	// Directory of the VMX file of the source VM, which relative paths
+	// are resolved against
+	SourceDir string
+	// Directory the clone is created in. It must differ from SourceDir,
+	// as disks keep their file names.
+	TargetDir string
+	// Create delta disks based on the disks of the source VM instead of
+	// copying them. The disks of the source VM must not change
+	// afterwards, which is usually ensured by taking a snapshot of it.
+	Linked bool
+}
+
+// CloneFile is a file of a clone, to be copied from the source VM or, for
+// linked clones, created as a delta disk. See Copy.
+type CloneFile struct {
+	// File of the source VM, empty for delta disks
+	Source string
+	Target string
+	// Disk a delta disk is based on
+	Parent string
+}
+
+// Copy creates the file, failing if it already exists.
+func (f CloneFile) Copy() error {
+	if f.Parent != "" {
+		return CreateDeltaDisk(f.Target, f.Parent)
+	}
+
+	src, err := os.Open(f.Source)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(f.Target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(f.Target)
+		return err
+	}
+	return dst.Close()
+}
+
+// Clone returns the configuration of a copy of vm, with a new identity, and
+// the files to copy for the clone to run. See Document.Clone.
+func (vm *VirtualMachine) Clone(opts CloneOptions) (*VirtualMachine, []CloneFile, error) {
+	data, err := Marshal(vm)
+	if err != nil {
+		return nil, nil, err
+	}
+	doc, err := ParseDocument(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	doc, files, err := doc.Clone(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	clone := new(VirtualMachine)
+	if err := doc.Decode(clone); err != nil {
+		return nil, nil, err
+	}
+	return clone, files, nil
+}
+
+// Clone returns the configuration of a copy of the VM, and the files to
+// copy for the clone to run, which are expected in opts.TargetDir. The
+// clone gets new BIOS and location UUIDs, MAC addresses are generated
+// again when it first powers on, except for static ones, and files
+// outside of the VM, such as ISO images, are referenced by their absolute
+// path. Encrypted VMs cannot be cloned.
+func (d *Document) Clone(opts CloneOptions) (*Document, []CloneFile, error) {
+	if opts.Name == "" {
+		return nil, nil, errors.New("Clone name is required")
+	}
+	if opts.TargetDir == "" {
+		return nil, nil, errors.New("Clone directory is required")
+	}
+	if samePath(absPath(opts.SourceDir), absPath(opts.TargetDir)) {
+		return nil, nil, errors.New("Clone must be created in another directory")
+	}
+	if _, found := d.Get("encryption.data"); found {
+		return nil, nil, ErrEncrypted
+	}
+
+	clone := d.Copy()
+	clone.Set("displayName", opts.Name)
+	clone.Set("uuid.bios", NewVMwareUUID().String())
+	clone.Set("uuid.location", NewVMwareUUID().String())
+	for _, key := range cloneRemovedKeys {
+		clone.Unset(key)
+	}
+	for _, e := range d.uniqueEntries() {
+		if generatedAddressRe.MatchString(e.Key) {
+			clone.Unset(e.Key)
+		}
+	}
+
+	c := &cloner{targets: make(map[string]bool)}
+	for _, f := range []struct{ key, ext string }{{"nvram", ".nvram"}, {"extendedConfigFile", ".vmxf"}} {
+		value, found := d.Get(f.key)
+		if !found {
+			continue
+		}
+		name := opts.Name + f.ext
+		clone.Set(f.key, name)
+		if source := resolvePath(opts.SourceDir, value); fileExists(source) {
+			if err := c.add(CloneFile{Source: source, Target: filepath.Join(opts.TargetDir, name)}); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	disks := make(map[string]bool)
+	for _, ref := range diskReferences(d) {
+		disks[strings.ToLower(ref.key)] = true
+		source := resolvePath(opts.SourceDir, ref.fileName)
+		clone.Set(ref.key, filepath.Base(source))
+
+		if opts.Linked {
+			err := c.add(CloneFile{Target: filepath.Join(opts.TargetDir, filepath.Base(source)), Parent: source})
+			if err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		chain, err := diskChain(source)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, f := range chain {
+			if err := c.add(CloneFile{Source: f, Target: filepath.Join(opts.TargetDir, filepath.Base(f))}); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	// Other files, such as ISO images, stay where they are.
+	for _, e := range d.uniqueEntries() {
+		device := DeviceOf(e.Key)
+		if device == "" || disks[strings.ToLower(e.Key)] || !strings.EqualFold(e.Key[len(device):], ".fileName") {
+			continue
+		}
+		if path := resolvePath(opts.SourceDir, e.Value); !filepath.IsAbs(e.Value) && fileExists(path) {
+			clone.Set(e.Key, absPath(path))
+		}
+	}
+	return clone, c.files, nil
+}
+
+// Collects the files of a clone, making sure they do not overwrite each
+// other.
+type cloner struct {
+	files   []CloneFile
+	targets map[string]bool
+}
+
+func (c *cloner) add(f CloneFile) error {
+	target := strings.ToLower(f.Target)
+	if c.targets[target] {
+		for _, existing := range c.files {
+			if strings.EqualFold(existing.Target, f.Target) && existing.Source == f.Source && existing.Parent == f.Parent {
+				// Parent disk shared by several disks
+				return nil
+			}
+		}
+		return fmt.Errorf("Several files would be copied to %s", f.Target)
+	}
+	c.targets[target] = true
+	c.files = append(c.files, f)
+	return nil
+}
+
+// Returns the files of the disk at path: its descriptor, its extents and
+// its parents, as long as they are referenced by relative paths. Parents
+// referenced by absolute paths are shared with the clone.
+func diskChain(path string) ([]string, error) {
+	var files []string
+	seen := make(map[string]bool)
+	for !seen[path] {
+		seen[path] = true
+		files = append(files, path)
+
+		d, err := ReadDiskDescriptor(path)
+		if err == ErrNotDescriptor {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range extentFiles(path, d) {
+			if f != path {
+				files = append(files, f)
+			}
+		}
+
+		if d.ParentFileNameHint == "" || filepath.IsAbs(d.ParentFileNameHint) {
+			break
+		}
+		path = resolvePath(filepath.Dir(path), d.ParentFileNameHint)
+	}
+	return files, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
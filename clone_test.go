@@ -0,0 +1,146 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testCloneVMX = `displayName = "core01"
+nvram = "core01.nvram"
+extendedConfigFile = "core01.vmxf"
+uuid.bios = "56 4d 3a 4f 01 23 45 67-89 ab cd ef 01 23 45 67"
+uuid.location = "56 4d 3a 4f 01 23 45 67-89 ab cd ef 01 23 45 67"
+vc.uuid = "52 1d 3a 4f 01 23 45 67-89 ab cd ef 01 23 45 67"
+ethernet0.present = "TRUE"
+ethernet0.addressType = "generated"
+ethernet0.generatedAddress = "00:0c:29:ab:cd:ef"
+ethernet0.generatedAddressOffset = "0"
+scsi0:0.present = "TRUE"
+scsi0:0.fileName = "core01.vmdk"
+ide1:0.present = "TRUE"
+ide1:0.deviceType = "cdrom-image"
+ide1:0.fileName = "../iso/core.iso"
+ide1:1.present = "TRUE"
+ide1:1.deviceType = "cdrom-raw"
+ide1:1.fileName = "auto detect"
+`
+
+// Creates a VM to clone in root/core01, returning the directory and the
+// parsed VMX file.
+func writeCloneSource(t *testing.T, root string) (string, *Document) {
+	write := func(name, contents string) {
+		path := filepath.Join(root, name)
+		ok(t, os.MkdirAll(filepath.Dir(path), 0755))
+		ok(t, ioutil.WriteFile(path, []byte(contents), 0644))
+	}
+	write("core01/core01.vmx", testCloneVMX)
+	write("core01/core01.nvram", "nvram")
+	write("core01/core01.vmdk", "# Disk DescriptorFile\nCID=fffffffe\nparentFileNameHint=\"base.vmdk\"\nRW 2048 SPARSE \"core01-s001.vmdk\"\n")
+	write("core01/core01-s001.vmdk", "sparse")
+	write("core01/base.vmdk", "# Disk DescriptorFile\nCID=12345678\nRW 2048 FLAT \"base-flat.vmdk\" 0\nddb.adapterType = \"lsilogic\"\n")
+	write("core01/base-flat.vmdk", "flat")
+	write("iso/core.iso", "iso")
+
+	doc, err := ParseDocument(strings.NewReader(testCloneVMX))
+	ok(t, err)
+	return filepath.Join(root, "core01"), doc
+}
+
+func TestClone(t *testing.T) {
+	root, err := ioutil.TempDir("", "govmx")
+	ok(t, err)
+	defer os.RemoveAll(root)
+
+	source, doc := writeCloneSource(t, root)
+	target := filepath.Join(root, "web01")
+	clone, files, err := doc.Clone(CloneOptions{Name: "web01", SourceDir: source, TargetDir: target})
+	ok(t, err)
+
+	get := func(key string) string {
+		value, _ := clone.Get(key)
+		return value
+	}
+	equals(t, "web01", get("displayName"))
+	equals(t, "web01.nvram", get("nvram"))
+	equals(t, "web01.vmxf", get("extendedConfigFile"))
+	equals(t, "core01.vmdk", get("scsi0:0.fileName"))
+	equals(t, filepath.Join(root, "iso", "core.iso"), get("ide1:0.fileName"))
+	equals(t, "auto detect", get("ide1:1.fileName"))
+
+	original, _ := doc.Get("uuid.bios")
+	assert(t, get("uuid.bios") != original, "expected a new BIOS UUID")
+	assert(t, get("uuid.bios") != get("uuid.location"), "expected different BIOS and location UUIDs")
+	_, err = ParseVMwareUUID(get("uuid.bios"))
+	ok(t, err)
+	for _, key := range []string{"vc.uuid", "ethernet0.generatedAddress", "ethernet0.generatedAddressOffset"} {
+		_, found := clone.Get(key)
+		assert(t, !found, "expected %s to be removed", key)
+	}
+
+	// The extended configuration file does not exist, VMware creates it.
+	equals(t, []CloneFile{
+		{Source: filepath.Join(source, "core01.nvram"), Target: filepath.Join(target, "web01.nvram")},
+		{Source: filepath.Join(source, "core01.vmdk"), Target: filepath.Join(target, "core01.vmdk")},
+		{Source: filepath.Join(source, "core01-s001.vmdk"), Target: filepath.Join(target, "core01-s001.vmdk")},
+		{Source: filepath.Join(source, "base.vmdk"), Target: filepath.Join(target, "base.vmdk")},
+		{Source: filepath.Join(source, "base-flat.vmdk"), Target: filepath.Join(target, "base-flat.vmdk")},
+	}, files)
+
+	ok(t, os.MkdirAll(target, 0755))
+	for _, f := range files {
+		ok(t, f.Copy())
+	}
+	data, err := ioutil.ReadFile(filepath.Join(target, "web01.nvram"))
+	ok(t, err)
+	equals(t, "nvram", string(data))
+	assert(t, files[0].Copy() != nil, "expected error overwriting %s", files[0].Target)
+
+	_, _, err = doc.Clone(CloneOptions{Name: "web01", SourceDir: source, TargetDir: source})
+	assert(t, err != nil, "expected error cloning into the source directory")
+	_, _, err = doc.Clone(CloneOptions{SourceDir: source, TargetDir: target})
+	assert(t, err != nil, "expected error cloning without name")
+}
+
+func TestLinkedClone(t *testing.T) {
+	root, err := ioutil.TempDir("", "govmx")
+	ok(t, err)
+	defer os.RemoveAll(root)
+
+	source, doc := writeCloneSource(t, root)
+	target := filepath.Join(root, "web01")
+	clone, files, err := doc.Clone(CloneOptions{Name: "web01", SourceDir: source, TargetDir: target, Linked: true})
+	ok(t, err)
+
+	fileName, _ := clone.Get("scsi0:0.fileName")
+	equals(t, "core01.vmdk", fileName)
+	disk := CloneFile{Target: filepath.Join(target, "core01.vmdk"), Parent: filepath.Join(source, "core01.vmdk")}
+	equals(t, disk, files[1])
+
+	ok(t, os.MkdirAll(target, 0755))
+	ok(t, disk.Copy())
+	d, err := ReadDiskDescriptor(disk.Target)
+	ok(t, err)
+	equals(t, "fffffffe", d.ParentCID)
+	equals(t, disk.Parent, d.ParentFileNameHint)
+	equals(t, int64(2048*512), d.Capacity())
+}
+
+func TestVirtualMachineClone(t *testing.T) {
+	vm := &VirtualMachine{
+		DisplayName: "core01",
+		UUID:        UUID{Bios: NewVMwareUUID()},
+		Ethernet:    []Ethernet{{VMXID: "ethernet0", Present: true, Address: "00:50:56:3a:4f:01", AddressType: MAC_TYPE_STATIC}},
+	}
+	clone, files, err := vm.Clone(CloneOptions{Name: "web01", TargetDir: "web01"})
+	ok(t, err)
+	equals(t, 0, len(files))
+	equals(t, "web01", clone.DisplayName)
+	assert(t, clone.UUID.Bios != vm.UUID.Bios, "expected a new BIOS UUID")
+	equals(t, vm.Ethernet, clone.Ethernet)
+}
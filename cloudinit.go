@@ -0,0 +1,179 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Volume label cloud-init looks for when searching for NoCloud seeds.
+const CloudInitSeedLabel = "cidata"
+
+// CloudInit holds the documents cloud-init configures guests with.
+type CloudInit struct {
+	MetaData      []byte
+	UserData      []byte
+	NetworkConfig []byte
+	VendorData    []byte
+}
+
+// InjectCloudInit passes ci to the guest through guestinfo variables, as
+// read by the VMware datasource of cloud-init, encoded with encoding. See
+// GuestInfo.SetPayload. The network configuration goes into the metadata,
+// under the network key, which requires the metadata to be a YAML or JSON
+// object without a network key of its own.
+func (vm *VirtualMachine) InjectCloudInit(ci *CloudInit, encoding string) error {
+	metadata := ci.MetaData
+	if len(ci.NetworkConfig) > 0 {
+		var err error
+		if metadata, err = withNetworkConfig(metadata, ci.NetworkConfig, encoding); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range []struct {
+		name string
+		data []byte
+	}{
+		{GuestInfoMetadata, metadata},
+		{GuestInfoUserdata, ci.UserData},
+		{GuestInfoVendordata, ci.VendorData},
+	} {
+		if len(p.data) == 0 {
+			vm.GuestInfo.Delete(p.name)
+			continue
+		}
+		if err := vm.GuestInfo.SetPayload(p.name, p.data, encoding); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Adds the network and network.encoding keys to metadata.
+func withNetworkConfig(metadata, network []byte, encoding string) ([]byte, error) {
+	if encoding == "" {
+		// The configuration is a multi-line document which cannot be
+		// embedded as it is.
+		encoding = GuestInfoEncodingBase64
+	}
+	value, err := encodePayload(network, encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	trimmed := bytes.TrimSpace(metadata)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		var m map[string]interface{}
+		if err := json.Unmarshal(trimmed, &m); err != nil {
+			return nil, fmt.Errorf("Invalid metadata: %v", err)
+		}
+		for _, k := range []string{"network", "network.encoding"} {
+			if _, found := m[k]; found {
+				return nil, fmt.Errorf("Metadata already has a %s key", k)
+			}
+		}
+		m["network"] = value
+		m["network.encoding"] = encoding
+		return json.Marshal(m)
+	}
+
+	// Duplicate keys are rejected by cloud-init, or resolved
+	// unpredictably.
+	for _, line := range strings.Split(string(metadata), "\n") {
+		if k := yamlTopLevelKey(line); k == "network" || k == "network.encoding" {
+			return nil, fmt.Errorf("Metadata already has a %s key", k)
+		}
+	}
+
+	var b bytes.Buffer
+	b.Write(metadata)
+	if len(metadata) > 0 && !bytes.HasSuffix(metadata, []byte("\n")) {
+		b.WriteByte('\n')
+	}
+	fmt.Fprintf(&b, "network: %s\nnetwork.encoding: %s\n", value, encoding)
+	return b.Bytes(), nil
+}
+
+// Returns the key of a top level YAML mapping entry, or an empty string
+// if line is anything else.
+func yamlTopLevelKey(line string) string {
+	if line == "" || strings.ContainsAny(line[:1], " \t-#") {
+		return ""
+	}
+	i := strings.Index(line, ":")
+	if i < 0 {
+		return ""
+	}
+	return strings.Trim(strings.TrimSpace(line[:i]), `"'`)
+}
+
+// WriteSeedISO writes to w a NoCloud seed for ci: an ISO image labeled
+// cidata holding the meta-data, user-data, network-config and
+// vendor-data files. The meta-data and user-data files are always
+// written, cloud-init requires them even if empty.
+func WriteSeedISO(w io.Writer, ci *CloudInit) error {
+	files := map[string][]byte{
+		"meta-data": ci.MetaData,
+		"user-data": ci.UserData,
+	}
+	if len(ci.NetworkConfig) > 0 {
+		files["network-config"] = ci.NetworkConfig
+	}
+	if len(ci.VendorData) > 0 {
+		files["vendor-data"] = ci.VendorData
+	}
+	return writeISO(w, CloudInitSeedLabel, files)
+}
+
+// AttachSeedISO writes the NoCloud seed for ci to the file at path and
+// attaches it to vm as a CD-ROM image on the given bus, IDE or SATA. A
+// CD-ROM already holding path is reused.
+func (vm *VirtualMachine) AttachSeedISO(path string, ci *CloudInit, bus BusType) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if err := WriteSeedISO(f, ci); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return vm.AttachCDROM(path, bus)
+}
+
+// AttachCDROM attaches the image at path to vm as a CD-ROM on the given
+// bus, IDE or SATA, unless a CD-ROM already holds it.
+func (vm *VirtualMachine) AttachCDROM(path string, bus BusType) error {
+	attached := vm.FindDevice(func(d Device) bool {
+		return d.Type == CDROM_IMAGE && d.Filename == path
+	}, bus)
+	if attached {
+		return nil
+	}
+
+	cdrom := Device{Present: true, StartConnected: true, Type: CDROM_IMAGE, Filename: path}
+	switch bus {
+	case IDE:
+		if len(vm.IDEDevices) >= MAX_IDE_ADAPTERS*MAX_IDE_DEVICES_PER_ADAPTER {
+			return fmt.Errorf("No IDE slot left for %s", path)
+		}
+		vm.IDEDevices = append(vm.IDEDevices, IDEDevice{Device: cdrom})
+	case SATA:
+		if len(vm.SATADevices) >= MAX_SATA_ADAPTERS*MAX_SATA_DEVICES_PER_ADAPTER {
+			return fmt.Errorf("No SATA slot left for %s", path)
+		}
+		vm.SATADevices = append(vm.SATADevices, SATADevice{Device: cdrom})
+	default:
+		return fmt.Errorf("CD-ROMs cannot be attached to %s", strings.ToUpper(string(bus)))
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testCloudInit = &CloudInit{
+	MetaData:      []byte("instance-id: core01\nlocal-hostname: core01\n"),
+	UserData:      []byte("#cloud-config\npackages: [nginx]\n"),
+	NetworkConfig: []byte("version: 2\nethernets:\n  ens192:\n    dhcp4: true\n"),
+}
+
+func TestInjectCloudInit(t *testing.T) {
+	vm := new(VirtualMachine)
+	vm.GuestInfo.Set("vendordata", "stale")
+	ok(t, vm.InjectCloudInit(testCloudInit, GuestInfoEncodingGzipBase64))
+
+	userdata, _, err := vm.GuestInfo.Userdata()
+	ok(t, err)
+	equals(t, testCloudInit.UserData, userdata)
+	_, found := vm.GuestInfo.Get("vendordata")
+	assert(t, !found, "expected guestinfo.vendordata to be removed")
+
+	metadata, _, err := vm.GuestInfo.Metadata()
+	ok(t, err)
+	lines := strings.Split(strings.TrimSpace(string(metadata)), "\n")
+	equals(t, 4, len(lines))
+	equals(t, "network.encoding: gzip+base64", lines[3])
+	network, err := decodePayload(strings.TrimPrefix(lines[2], "network: "), GuestInfoEncodingGzipBase64)
+	ok(t, err)
+	equals(t, testCloudInit.NetworkConfig, network)
+
+	// JSON metadata, and network configuration encoded even if the rest
+	// is not.
+	ci := &CloudInit{MetaData: []byte(`{"instance-id": "core01"}`), NetworkConfig: testCloudInit.NetworkConfig}
+	ok(t, vm.InjectCloudInit(ci, ""))
+	value, _ := vm.GuestInfo.Get("metadata")
+	var m map[string]string
+	ok(t, json.Unmarshal([]byte(value), &m))
+	equals(t, "core01", m["instance-id"])
+	equals(t, GuestInfoEncodingBase64, m["network.encoding"])
+	_, found = vm.GuestInfo.Get("userdata")
+	assert(t, !found, "expected guestinfo.userdata to be removed")
+
+	// Metadata with a network key of its own.
+	for _, metadata := range []string{
+		"instance-id: core01\nnetwork:\n  version: 2\n",
+		`{"instance-id": "core01", "network": "e30="}`,
+	} {
+		ci.MetaData = []byte(metadata)
+		err = vm.InjectCloudInit(ci, "")
+		assert(t, err != nil, "expected error for duplicate network key in %s", metadata)
+	}
+}
+
+func TestAttachSeedISO(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govmx")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+
+	vm := &VirtualMachine{IDEDevices: []IDEDevice{{Device{Present: true, Type: "disk", Filename: "core01.vmdk"}}}}
+	path := filepath.Join(dir, "seed.iso")
+	ok(t, vm.AttachSeedISO(path, testCloudInit, IDE))
+	ok(t, vm.AttachSeedISO(path, testCloudInit, IDE))
+	equals(t, 2, len(vm.IDEDevices))
+
+	data, err := Marshal(vm)
+	ok(t, err)
+	assert(t, strings.Contains(string(data), `ide0:1.devicetype = "cdrom-image"`), "expected a CD-ROM in:\n%s", data)
+
+	image, err := ioutil.ReadFile(path)
+	ok(t, err)
+	files := readISORoot(t, image, isoJolietSector)
+	for _, name := range []string{"meta-data", "user-data", "network-config"} {
+		_, found := files[name]
+		assert(t, found, "expected %s in the seed", name)
+	}
+
+	err = vm.AttachCDROM(path, SCSI)
+	assert(t, err != nil, "expected error attaching a CD-ROM to SCSI")
+}
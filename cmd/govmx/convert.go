@@ -0,0 +1,81 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	vmx "github.com/hooklift/govmx"
+)
+
+var cmdConvert = &command{
+	name: "convert",
+	args: "-to json|yaml|vmx [-from json|yaml|vmx] [-redact] [file]",
+	help: "convert between VMX and nested JSON or YAML",
+	run: func(args []string) error {
+		flags := flag.NewFlagSet("convert", flag.ContinueOnError)
+		to := flags.String("to", "", "output format: json, yaml or vmx")
+		from := flags.String("from", "", "input format: json, yaml or vmx, guessed from the file extension by default")
+		redact := flags.Bool("redact", false, "hide passwords, keys and guestinfo values")
+		if err := flags.Parse(args); err != nil {
+			return usageError(err.Error())
+		}
+
+		if flags.NArg() > 1 {
+			return usageError("expected at most one file")
+		}
+
+		var data []byte
+		var err error
+		if flags.NArg() == 0 {
+			data, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			data, err = ioutil.ReadFile(flags.Arg(0))
+			if *from == "" {
+				*from = strings.TrimPrefix(filepath.Ext(flags.Arg(0)), ".")
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		var doc *vmx.Document
+		switch strings.ToLower(*from) {
+		case "json":
+			doc, err = vmx.FromJSON(data)
+		case "yaml", "yml":
+			doc, err = vmx.FromYAML(data)
+		default:
+			doc, err = vmx.ParseDocument(strings.NewReader(string(data)))
+		}
+		if err != nil {
+			return err
+		}
+		if *redact {
+			doc = vmx.Redact(doc)
+		}
+
+		switch strings.ToLower(*to) {
+		case "json":
+			data, err = vmx.ToJSON(doc)
+		case "yaml", "yml":
+			data = vmx.ToYAML(doc)
+		case "vmx":
+			data = doc.Bytes()
+		default:
+			return usageError(fmt.Sprintf("unknown output format %q", *to))
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = os.Stdout.Write(data)
+		return err
+	},
+}
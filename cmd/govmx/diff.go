@@ -0,0 +1,51 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	vmx "github.com/hooklift/govmx"
+)
+
+var cmdDiff = &command{
+	name: "diff",
+	args: "[-json] <old file> <new file>",
+	help: "compare two files, key casing and ordering aside",
+	run: func(args []string) error {
+		flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+		asJSON := flags.Bool("json", false, "print changes as a JSON patch")
+		if err := flags.Parse(args); err != nil {
+			return usageError(err.Error())
+		}
+
+		if flags.NArg() != 2 {
+			return usageError("expected two files")
+		}
+
+		a, err := readDocument(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+
+		b, err := readDocument(flags.Arg(1))
+		if err != nil {
+			return err
+		}
+
+		changes := vmx.Diff(a, b)
+		if !*asJSON {
+			fmt.Print(changes)
+			return nil
+		}
+
+		patch, err := changes.JSONPatch()
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(patch))
+		return nil
+	},
+}
@@ -0,0 +1,108 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	vmx "github.com/hooklift/govmx"
+)
+
+var cmdGet = &command{
+	name: "get",
+	args: "<file> <key>",
+	help: "print the value of a key",
+	run: func(args []string) error {
+		if len(args) != 2 {
+			return usageError("expected a file and a key")
+		}
+
+		doc, err := readDocument(args[0])
+		if err != nil {
+			return err
+		}
+
+		value, found := doc.Get(args[1])
+		if !found {
+			return fmt.Errorf("%s: key not found: %s", args[0], args[1])
+		}
+		fmt.Println(value)
+		return nil
+	},
+}
+
+var cmdSet = &command{
+	name: "set",
+	args: "<file> <key> <value>",
+	help: "set the value of a key, adding it if needed",
+	run: func(args []string) error {
+		if len(args) != 3 {
+			return usageError("expected a file, a key and a value")
+		}
+
+		doc, snapshot, err := editDocument(args[0])
+		if err != nil {
+			return err
+		}
+
+		doc.Set(args[1], args[2])
+		return writeDocument(args[0], doc, snapshot)
+	},
+}
+
+var cmdUnset = &command{
+	name: "unset",
+	args: "<file> <key>",
+	help: "remove a key, if present",
+	run: func(args []string) error {
+		if len(args) != 2 {
+			return usageError("expected a file and a key")
+		}
+
+		doc, snapshot, err := editDocument(args[0])
+		if err != nil {
+			return err
+		}
+
+		if !doc.Unset(args[1]) {
+			return nil
+		}
+		return writeDocument(args[0], doc, snapshot)
+	},
+}
+
+var cmdList = &command{
+	name: "list",
+	args: "[-redact] <file>",
+	help: "print every key and its value",
+	run: func(args []string) error {
+		flags := flag.NewFlagSet("list", flag.ContinueOnError)
+		redact := flags.Bool("redact", false, "hide passwords, keys and guestinfo values")
+		if err := flags.Parse(args); err != nil {
+			return usageError(err.Error())
+		}
+
+		if flags.NArg() != 1 {
+			return usageError("expected a file")
+		}
+
+		doc, err := readDocument(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		if *redact {
+			doc = vmx.Redact(doc)
+		}
+
+		// Copying the entries into an empty document drops comments and
+		// duplicated keys while keeping VMware's quoting.
+		list := new(vmx.Document)
+		for _, e := range doc.Entries() {
+			list.Set(e.Key, e.Value)
+		}
+		fmt.Print(list)
+		return nil
+	},
+}
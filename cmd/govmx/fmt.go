@@ -0,0 +1,184 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	vmx "github.com/hooklift/govmx"
+)
+
+var cmdFmt = &command{
+	name: "fmt",
+	args: "[-l] [-d] [-w] [files...]",
+	help: "rewrite files in canonical form, reading stdin if no files are given",
+	run: func(args []string) error {
+		flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+		list := flags.Bool("l", false, "list files whose formatting differs from govmx fmt's")
+		diff := flags.Bool("d", false, "display diffs instead of rewriting files")
+		write := flags.Bool("w", false, "write result to the source file instead of stdout")
+		if err := flags.Parse(args); err != nil {
+			return usageError(err.Error())
+		}
+
+		if flags.NArg() == 0 {
+			if *write {
+				return usageError("cannot use -w with standard input")
+			}
+			src, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				return err
+			}
+			return formatFile("<standard input>", src, *list, *diff, false)
+		}
+
+		for _, path := range flags.Args() {
+			src, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if err := formatFile(path, src, *list, *diff, *write); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+func formatFile(path string, src []byte, list, diff, write bool) error {
+	formatted, err := vmx.Format(src)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	changed := !bytes.Equal(src, formatted)
+	if list && changed {
+		fmt.Println(path)
+	}
+
+	if write && changed {
+		doc, err := vmx.ParseDocument(bytes.NewReader(formatted))
+		if err != nil {
+			return err
+		}
+		if err := vmx.WriteFile(path, doc, nil); err != nil {
+			return err
+		}
+	}
+
+	if diff && changed {
+		fmt.Print(unifiedDiff(path, string(src), string(formatted)))
+	}
+
+	if !list && !write && !diff {
+		os.Stdout.Write(formatted)
+	}
+	return nil
+}
+
+// Number of unchanged lines shown around each change.
+const diffContext = 3
+
+// Returns a unified diff between a and b. VMX files are small, so a plain
+// longest common subsequence table is good enough.
+func unifiedDiff(name, a, b string) string {
+	x := strings.SplitAfter(a, "\n")
+	y := strings.SplitAfter(b, "\n")
+	if x[len(x)-1] == "" {
+		x = x[:len(x)-1]
+	}
+	if y[len(y)-1] == "" {
+		y = y[:len(y)-1]
+	}
+
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	// Edit script, one operation per line: ' ', '-' or '+'.
+	type op struct {
+		kind byte
+		line string
+		// Line numbers in a and b before applying the operation.
+		i, j int
+	}
+	var ops []op
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			ops = append(ops, op{' ', x[i], i, j})
+			i++
+			j++
+		case j < len(y) && (i == len(x) || lcs[i][j+1] >= lcs[i+1][j]):
+			ops = append(ops, op{'+', y[j], i, j})
+			j++
+		default:
+			ops = append(ops, op{'-', x[i], i, j})
+			i++
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "--- %s.orig\n+++ %s\n", name, name)
+	for start := 0; start < len(ops); {
+		if ops[start].kind == ' ' {
+			start++
+			continue
+		}
+
+		// Extends the hunk while changes are close enough to share context.
+		first := start - diffContext
+		if first < 0 {
+			first = 0
+		}
+		end := start
+		for k := start; k < len(ops) && k <= end+2*diffContext; k++ {
+			if ops[k].kind != ' ' {
+				end = k
+			}
+		}
+		last := end + diffContext
+		if last >= len(ops) {
+			last = len(ops) - 1
+		}
+
+		countA, countB := 0, 0
+		for _, o := range ops[first : last+1] {
+			if o.kind != '+' {
+				countA++
+			}
+			if o.kind != '-' {
+				countB++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", ops[first].i+1, countA, ops[first].j+1, countB)
+		for _, o := range ops[first : last+1] {
+			out.WriteByte(o.kind)
+			out.WriteString(o.line)
+			if !strings.HasSuffix(o.line, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		start = last + 1
+	}
+	return out.String()
+}
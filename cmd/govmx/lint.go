@@ -0,0 +1,190 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	vmx "github.com/hooklift/govmx"
+)
+
+// Configuration file looked up in the current directory when -config is
+// not given.
+const defaultLintConfig = ".govmxlint"
+
+var cmdLint = &command{
+	name: "lint",
+	args: "[-config file] [-format text|sarif] <files...>",
+	help: "report configuration best-practice violations",
+	run: func(args []string) error {
+		flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+		configPath := flags.String("config", "", "lint configuration file, "+defaultLintConfig+" by default")
+		format := flags.String("format", "text", "output format: text or sarif")
+		if err := flags.Parse(args); err != nil {
+			return usageError(err.Error())
+		}
+
+		if flags.NArg() == 0 {
+			return usageError("expected at least one file")
+		}
+		if *format != "text" && *format != "sarif" {
+			return usageError(fmt.Sprintf("unknown format %q", *format))
+		}
+
+		config, err := readLintConfig(*configPath)
+		if err != nil {
+			return err
+		}
+
+		results := make(map[string][]vmx.Finding)
+		failed := false
+		for _, path := range flags.Args() {
+			findings, err := vmx.LintFile(path, config)
+			if err != nil {
+				return fmt.Errorf("%s: %v", path, err)
+			}
+			results[path] = findings
+
+			for _, f := range findings {
+				if f.Severity == vmx.SeverityError {
+					failed = true
+				}
+				if *format == "text" {
+					fmt.Printf("%s:%s\n", path, f)
+				}
+			}
+		}
+
+		if *format == "sarif" {
+			data, err := sarifReport(flags.Args(), results)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+		}
+
+		if failed {
+			return errors.New("errors found")
+		}
+		return nil
+	},
+}
+
+func readLintConfig(path string) (*vmx.LintConfig, error) {
+	explicit := path != ""
+	if !explicit {
+		path = defaultLintConfig
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) && !explicit {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	config, err := vmx.ParseLintConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return config, nil
+}
+
+// Minimal subset of SARIF 2.1.0 needed to report findings.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string       `json:"id"`
+	ShortDescription     sarifMessage `json:"shortDescription"`
+	DefaultConfiguration struct {
+		Level vmx.Severity `json:"level"`
+	} `json:"defaultConfiguration"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     vmx.Severity    `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+		Region *sarifRegion `json:"region,omitempty"`
+	} `json:"physicalLocation"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+func sarifReport(paths []string, results map[string][]vmx.Finding) ([]byte, error) {
+	driver := sarifDriver{
+		Name:           "govmx",
+		InformationURI: "https://github.com/hooklift/govmx",
+	}
+	for _, r := range vmx.LintRules() {
+		rule := sarifRule{ID: r.ID, ShortDescription: sarifMessage{r.Description}}
+		rule.DefaultConfiguration.Level = r.Severity
+		driver.Rules = append(driver.Rules, rule)
+	}
+
+	run := sarifRun{Tool: sarifTool{driver}, Results: []sarifResult{}}
+	for _, path := range paths {
+		for _, f := range results[path] {
+			var location sarifLocation
+			location.PhysicalLocation.ArtifactLocation.URI = filepath.ToSlash(path)
+			// Findings about missing keys have no line to point at.
+			if f.Line > 0 {
+				location.PhysicalLocation.Region = &sarifRegion{StartLine: f.Line}
+			}
+
+			run.Results = append(run.Results, sarifResult{
+				RuleID:    f.Rule,
+				Level:     f.Severity,
+				Message:   sarifMessage{f.Message},
+				Locations: []sarifLocation{location},
+			})
+		}
+	}
+
+	return json.MarshalIndent(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}, "", "  ")
+}
@@ -0,0 +1,124 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Command govmx inspects and edits VMware VMX files using the govmx parser,
+// so that values are quoted and escaped the way VMware expects and the rest
+// of the file is left untouched.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	vmx "github.com/hooklift/govmx"
+)
+
+type command struct {
+	name string
+	// Arguments synopsis, shown in the usage message.
+	args string
+	help string
+	run  func(args []string) error
+}
+
+var commands = []*command{
+	cmdGet,
+	cmdSet,
+	cmdUnset,
+	cmdList,
+	cmdDiff,
+	cmdFmt,
+	cmdConvert,
+	cmdLint,
+}
+
+// usageError is returned by commands invoked with the wrong arguments.
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: govmx <command> [arguments]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-40s %s\n", c.name+" "+c.args, c.help)
+	}
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := flag.Arg(0)
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+
+		err := c.run(flag.Args()[1:])
+		if err == nil {
+			return
+		}
+
+		if _, ok := err.(usageError); ok {
+			fmt.Fprintf(os.Stderr, "govmx %s: %v\nUsage: govmx %s %s\n", c.name, err, c.name, c.args)
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "govmx %s: %s\n", c.name, strings.TrimSpace(err.Error()))
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "govmx: unknown command %q\n", name)
+	usage()
+	os.Exit(2)
+}
+
+// Reads and parses the VMX file at path.
+func readDocument(path string) (*vmx.Document, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	doc, err := vmx.ParseDocument(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return doc, nil
+}
+
+// Reads a document that is going to be written back with writeDocument.
+func editDocument(path string) (*vmx.Document, *vmx.FileSnapshot, error) {
+	doc := new(vmx.Document)
+	snapshot, err := vmx.ReadFile(path, doc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return doc, snapshot, nil
+}
+
+// Writes doc back to path atomically, failing if the file is locked or
+// if it changed since snapshot was taken.
+func writeDocument(path string, doc *vmx.Document, snapshot *vmx.FileSnapshot) error {
+	lock, err := vmx.AcquireLock(path, 0)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	err = vmx.WriteFile(path, doc, &vmx.WriteOptions{Snapshot: snapshot, Lock: lock})
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
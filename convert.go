@@ -0,0 +1,466 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Node is a VMX document, or part of it, represented as a tree. Keys are
+// split on dots, so that ethernet0.virtualDev becomes the virtualDev child
+// of the ethernet0 node. Device names such as scsi0:1 or usb:0 are kept
+// as a single node.
+//
+// A node may have both a value and children when the document has keys
+// like a.b and a.b.c. In JSON and YAML such value is stored under an
+// empty name.
+type Node struct {
+	Name     string
+	Value    string
+	HasValue bool
+	Children []*Node
+}
+
+// Child returns the child named name, or nil if there is none.
+func (n *Node) Child(name string) *Node {
+	for _, c := range n.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// Returns the child named name, adding it if it does not exist.
+func (n *Node) child(name string) *Node {
+	if c := n.Child(name); c != nil {
+		return c
+	}
+	c := &Node{Name: name}
+	n.Children = append(n.Children, c)
+	return c
+}
+
+// Tree converts doc into a tree. Children keep the order in which their
+// keys first appear in doc.
+func Tree(doc *Document) *Node {
+	root := new(Node)
+	values := doc.Map()
+	for _, e := range doc.Entries() {
+		n := root
+		for _, name := range splitKey(e.Key) {
+			n = n.child(name)
+		}
+		n.Value = values[strings.ToLower(e.Key)]
+		n.HasValue = true
+	}
+	return root
+}
+
+// Splits a key in its tree path. Leading dots, as in .encoding, are part
+// of the first name. Keys that would produce empty names, like a..b, are
+// not split at all.
+func splitKey(key string) []string {
+	prefix := ""
+	rest := key
+	for strings.HasPrefix(rest, ".") {
+		prefix += "."
+		rest = rest[1:]
+	}
+
+	names := strings.Split(rest, ".")
+	names[0] = prefix + names[0]
+	for _, name := range names {
+		if name == "" || name == "." {
+			return []string{key}
+		}
+	}
+	return names
+}
+
+// Document converts a tree back into a VMX document.
+func (n *Node) Document() *Document {
+	doc := new(Document)
+	n.walk("", func(key, value string) {
+		doc.Set(key, value)
+	})
+	return doc
+}
+
+func (n *Node) walk(key string, f func(key, value string)) {
+	if n.HasValue && key != "" {
+		f(key, n.Value)
+	}
+	for _, c := range n.Children {
+		k := c.Name
+		if key != "" {
+			k = key + "." + c.Name
+		}
+		c.walk(k, f)
+	}
+}
+
+// MarshalJSON encodes the node as nested JSON objects whose leaves are
+// strings. Members keep the order of the children.
+func (n *Node) MarshalJSON() ([]byte, error) {
+	if len(n.Children) == 0 && n.Name != "" {
+		return json.Marshal(n.Value)
+	}
+
+	var b bytes.Buffer
+	b.WriteByte('{')
+	if n.HasValue {
+		value, _ := json.Marshal(n.Value)
+		b.WriteString(`"":`)
+		b.Write(value)
+	}
+	for i, c := range n.Children {
+		if i > 0 || n.HasValue {
+			b.WriteByte(',')
+		}
+		name, _ := json.Marshal(c.Name)
+		b.Write(name)
+		b.WriteByte(':')
+		value, err := c.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// UnmarshalJSON decodes nested JSON objects into the node. Numbers and
+// booleans are accepted as leaves and converted to strings. Members keep
+// the order in which they appear in data.
+func (n *Node) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return errors.New("Empty JSON value")
+	}
+
+	switch data[0] {
+	case '"':
+		var value string
+		if err := json.Unmarshal(data, &value); err != nil {
+			return err
+		}
+		n.Value, n.HasValue = value, true
+		return nil
+	case '{':
+	case '[':
+		return fmt.Errorf("Unsupported JSON value for %q: arrays are not valid VMX values", n.Name)
+	case 'n':
+		return fmt.Errorf("Unsupported JSON value for %q: %s", n.Name, data)
+	default:
+		// Numbers and booleans, as they were written.
+		n.Value, n.HasValue = string(data), true
+		return nil
+	}
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range jsonMemberNames(data) {
+		// As with encoding/json, the last of duplicate members wins.
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		c := &Node{Name: name}
+		if err := c.UnmarshalJSON(members[name]); err != nil {
+			return err
+		}
+
+		if name == "" {
+			if len(c.Children) > 0 {
+				return fmt.Errorf("Empty member name in %q must have a string value", n.Name)
+			}
+			n.Value, n.HasValue = c.Value, true
+			continue
+		}
+		n.Children = append(n.Children, c)
+	}
+	return nil
+}
+
+// Returns the member names of the valid JSON object in data, in the order
+// they appear. Names are the strings of the outermost object followed by
+// a colon.
+func jsonMemberNames(data []byte) []string {
+	var names []string
+	depth := 0
+	for i := 0; i < len(data); i++ {
+		switch data[i] {
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+		case '"':
+			end := i + 1
+			for ; end < len(data) && data[end] != '"'; end++ {
+				if data[end] == '\\' {
+					end++
+				}
+			}
+			next := bytes.TrimLeft(data[end+1:], " \t\r\n")
+			if depth == 1 && len(next) > 0 && next[0] == ':' {
+				var name string
+				json.Unmarshal(data[i:end+1], &name)
+				names = append(names, name)
+			}
+			i = end
+		}
+	}
+	return names
+}
+
+// ToJSON converts doc into indented JSON. See Node.
+func ToJSON(doc *Document) ([]byte, error) {
+	data, err := json.Marshal(Tree(doc))
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	if err := json.Indent(&b, data, "", "  "); err != nil {
+		return nil, err
+	}
+	b.WriteByte('\n')
+	return b.Bytes(), nil
+}
+
+// FromJSON converts JSON produced by ToJSON, or written by hand following
+// the same structure, back into a VMX document.
+func FromJSON(data []byte) (*Document, error) {
+	root := new(Node)
+	if err := json.Unmarshal(data, root); err != nil {
+		return nil, err
+	}
+	if len(root.Children) == 0 && root.HasValue {
+		return nil, errors.New("JSON document must be an object")
+	}
+	return root.Document(), nil
+}
+
+// ToYAML converts doc into YAML, using block mappings and double quoted
+// values. See Node.
+func ToYAML(doc *Document) []byte {
+	var b bytes.Buffer
+	Tree(doc).writeYAML(&b, 0)
+	return b.Bytes()
+}
+
+func (n *Node) writeYAML(b *bytes.Buffer, depth int) {
+	indent := strings.Repeat("  ", depth)
+	if n.HasValue && n.Name != "" && len(n.Children) > 0 {
+		fmt.Fprintf(b, "%s\"\": %s\n", indent, strconv.Quote(n.Value))
+	}
+
+	for _, c := range n.Children {
+		if len(c.Children) == 0 {
+			fmt.Fprintf(b, "%s%s: %s\n", indent, yamlKey(c.Name), strconv.Quote(c.Value))
+			continue
+		}
+		fmt.Fprintf(b, "%s%s:\n", indent, yamlKey(c.Name))
+		c.writeYAML(b, depth+1)
+	}
+}
+
+// Plain scalars YAML 1.1 parsers read as booleans, null or special
+// floats rather than strings.
+var yamlReservedKeys = map[string]bool{
+	"y": true, "yes": true, "n": true, "no": true,
+	"true": true, "false": true, "on": true, "off": true,
+	"null": true, ".inf": true, "+.inf": true, ".nan": true,
+}
+
+// Quotes YAML keys unless they are plain scalars that YAML 1.1 parsers
+// read as strings.
+func yamlKey(name string) string {
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_' || c == '-' || c == '.') {
+			return strconv.Quote(name)
+		}
+	}
+	if name == "" || name[0] == '-' || yamlReservedKeys[strings.ToLower(name)] {
+		return strconv.Quote(name)
+	}
+	if _, err := strconv.ParseFloat(strings.Replace(name, "_", "", -1), 64); err == nil {
+		return strconv.Quote(name)
+	}
+	return name
+}
+
+// FromYAML converts YAML produced by ToYAML back into a VMX document. Only
+// block mappings with scalar values are supported, which is all a VMX
+// document needs.
+func FromYAML(data []byte) (*Document, error) {
+	type level struct {
+		indent int
+		node   *Node
+	}
+
+	root := new(Node)
+	// Indentation of top level keys is set by the first one found.
+	stack := []level{{-1, root}}
+	// Node expecting children on the following, more indented, lines.
+	var open *Node
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", lineNum)
+		}
+		indent := len(line) - len(trimmed)
+
+		switch {
+		case stack[0].indent < 0:
+			stack[0].indent = indent
+		case open != nil:
+			if indent <= stack[len(stack)-1].indent {
+				return nil, fmt.Errorf("line %d: expected an indented mapping for %q", lineNum, open.Name)
+			}
+			stack = append(stack, level{indent, open})
+		default:
+			for len(stack) > 1 && indent < stack[len(stack)-1].indent {
+				stack = stack[:len(stack)-1]
+			}
+			if indent != stack[len(stack)-1].indent {
+				return nil, fmt.Errorf("line %d: inconsistent indentation", lineNum)
+			}
+		}
+		open = nil
+		parent := stack[len(stack)-1].node
+
+		name, rest, err := parseYAMLKey(trimmed)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+
+		if rest == "" {
+			if name == "" {
+				return nil, fmt.Errorf("line %d: empty key must have a value", lineNum)
+			}
+			open = parent.child(name)
+			continue
+		}
+
+		value, err := parseYAMLScalar(rest)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+
+		n := parent
+		if name != "" {
+			n = parent.child(name)
+		}
+		n.Value, n.HasValue = value, true
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if open != nil {
+		return nil, fmt.Errorf("missing value for %q", open.Name)
+	}
+	return root.Document(), nil
+}
+
+// Splits "key: value" returning the unquoted key and the raw value.
+func parseYAMLKey(line string) (string, string, error) {
+	if strings.HasPrefix(line, `"`) || strings.HasPrefix(line, "'") {
+		end := closingQuote(line)
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated key: %s", line)
+		}
+		name, err := unquoteYAML(line[:end+1])
+		if err != nil {
+			return "", "", err
+		}
+		rest := strings.TrimSpace(line[end+1:])
+		if !strings.HasPrefix(rest, ":") {
+			return "", "", fmt.Errorf("expected a colon after key: %s", line)
+		}
+		return name, strings.TrimSpace(rest[1:]), nil
+	}
+
+	if strings.HasPrefix(line, "- ") || line == "-" {
+		return "", "", errors.New("sequences are not supported")
+	}
+
+	i := strings.Index(line, ": ")
+	if i < 0 {
+		if !strings.HasSuffix(line, ":") {
+			return "", "", fmt.Errorf("expected key: value, got %s", line)
+		}
+		i = len(line) - 1
+	}
+	return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]), nil
+}
+
+func parseYAMLScalar(s string) (string, error) {
+	if strings.HasPrefix(s, `"`) || strings.HasPrefix(s, "'") {
+		end := closingQuote(s)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated value: %s", s)
+		}
+		rest := strings.TrimSpace(s[end+1:])
+		if rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected text after value: %s", rest)
+		}
+		return unquoteYAML(s[:end+1])
+	}
+
+	switch s[0] {
+	case '{', '[', '|', '>', '&', '*', '!':
+		return "", fmt.Errorf("unsupported YAML value: %s", s)
+	}
+
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	return s, nil
+}
+
+// Returns the index of the quote closing the quoted scalar at the start
+// of s, or -1.
+func closingQuote(s string) int {
+	q := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case q == '"' && s[i] == '\\':
+			i++
+		case q == '\'' && s[i] == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			i++
+		case s[i] == q:
+			return i
+		}
+	}
+	return -1
+}
+
+func unquoteYAML(s string) (string, error) {
+	if s[0] == '\'' {
+		return strings.Replace(s[1:len(s)-1], "''", "'", -1), nil
+	}
+	return strconv.Unquote(s)
+}
@@ -0,0 +1,148 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const convertSample = `.encoding = "UTF-8"
+displayName = "core01"
+annotation = "Line 1|0ALine |22two|22"
+sched.mem = "shares"
+sched.mem.pshare.enable = "FALSE"
+scsi0.present = "TRUE"
+scsi0:1.fileName = "disk.vmdk"
+usb:0.deviceType = "hid"
+`
+
+func TestToJSON(t *testing.T) {
+	doc, err := ParseDocument(strings.NewReader(convertSample))
+	ok(t, err)
+
+	data, err := ToJSON(doc)
+	ok(t, err)
+	equals(t, `{
+  ".encoding": "UTF-8",
+  "displayName": "core01",
+  "annotation": "Line 1\nLine \"two\"",
+  "sched": {
+    "mem": {
+      "": "shares",
+      "pshare": {
+        "enable": "FALSE"
+      }
+    }
+  },
+  "scsi0": {
+    "present": "TRUE"
+  },
+  "scsi0:1": {
+    "fileName": "disk.vmdk"
+  },
+  "usb:0": {
+    "deviceType": "hid"
+  }
+}
+`, string(data))
+
+	back, err := FromJSON(data)
+	ok(t, err)
+	equals(t, convertSample, back.String())
+
+	_, err = FromJSON([]byte(`{"ethernet0": {"present": ["TRUE"]}}`))
+	assert(t, err != nil, "arrays should not be accepted")
+
+	back, err = FromJSON([]byte(`{"memsize": 1024, "mem": {"hotadd": true}}`))
+	ok(t, err)
+	equals(t, "memsize = \"1024\"\nmem.hotadd = \"true\"\n", back.String())
+
+	// Members keep their order, even with escaped quotes and nested
+	// objects in between, and the last of duplicate members wins.
+	back, err = FromJSON([]byte(`{"z\"q": "a:b", "sched": {"mem": {"": "shares", "max": "2"}}, "a": "x", "z\"q": "c"}`))
+	ok(t, err)
+	equals(t, "z\"q = \"c\"\nsched.mem = \"shares\"\nsched.mem.max = \"2\"\na = \"x\"\n", back.String())
+
+	_, err = FromJSON([]byte(`{"memsize": null}`))
+	assert(t, err != nil, "null should not be accepted")
+}
+
+func TestToYAML(t *testing.T) {
+	doc, err := ParseDocument(strings.NewReader(convertSample))
+	ok(t, err)
+
+	data := ToYAML(doc)
+	equals(t, `.encoding: "UTF-8"
+displayName: "core01"
+annotation: "Line 1\nLine \"two\""
+sched:
+  mem:
+    "": "shares"
+    pshare:
+      enable: "FALSE"
+scsi0:
+  present: "TRUE"
+"scsi0:1":
+  fileName: "disk.vmdk"
+"usb:0":
+  deviceType: "hid"
+`, string(data))
+
+	back, err := FromYAML(data)
+	ok(t, err)
+	equals(t, convertSample, back.String())
+
+	back, err = FromYAML([]byte(`# hand written
+---
+displayName: core01 # trailing comment
+ethernet0:
+    present: 'TRUE'
+    virtualDev: "vmxnet3"
+memsize: 1024
+`))
+	ok(t, err)
+	equals(t, `displayName = "core01"
+ethernet0.present = "TRUE"
+ethernet0.virtualDev = "vmxnet3"
+memsize = "1024"
+`, back.String())
+
+	// Keys YAML parsers would read as booleans, null or numbers are quoted.
+	for name, key := range map[string]string{
+		"yes": `"yes"`, "Off": `"Off"`, "null": `"null"`, "~": `"~"`, "10": `"10"`, "1e3": `"1e3"`,
+		"ethernet0": "ethernet0", "yesterday": "yesterday",
+	} {
+		equals(t, key, yamlKey(name))
+	}
+
+	_, err = FromYAML([]byte("ethernet0:\n  - present\n"))
+	assert(t, err != nil, "sequences should not be accepted")
+
+	_, err = FromYAML([]byte("ethernet0:\n    present: x\n  virtualDev: y\n"))
+	assert(t, err != nil, "inconsistent indentation should be reported")
+}
+
+func TestConvertFixtures(t *testing.T) {
+	for _, name := range []string{"a.vmx", "b.vmx"} {
+		data, err := ioutil.ReadFile(filepath.Join(".", "fixtures", name))
+		ok(t, err)
+
+		doc, err := ParseDocument(bytes.NewReader(data))
+		ok(t, err)
+
+		j, err := ToJSON(doc)
+		ok(t, err)
+		fromJSON, err := FromJSON(j)
+		ok(t, err)
+		equals(t, 0, len(Diff(doc, fromJSON)))
+
+		fromYAML, err := FromYAML(ToYAML(doc))
+		ok(t, err)
+		equals(t, 0, len(Diff(doc, fromYAML)))
+	}
+}
@@ -5,6 +5,7 @@ package vmx
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -12,6 +13,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 type Decoder struct {
@@ -26,6 +28,11 @@ type Decoder struct {
 	// Report an error if there are keys in the Go structure
 	// that do not have a match in the VMX file
 	ErrorUnmatched bool
+
+	// Key of encrypted VMs, used to decrypt encryption.data. Without it,
+	// Decode only decodes the keys stored in plaintext and returns
+	// ErrEncrypted.
+	EncryptionKey []byte
 }
 
 func NewDecoder(reader io.Reader, errorUnmatched bool) *Decoder {
@@ -47,26 +54,18 @@ func (d *Decoder) loadVMXMap() error {
 		line := d.scanner.Text()
 
 		// Ignore comments and empty lines
-		if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
+		if isBlankOrComment(line) {
 			continue
 		}
 
-		parts := strings.Split(line, "=")
-		if len(parts) != 2 {
-			errors = appendErrors(errors, fmt.Errorf("Invalid line: %s ", line))
-		}
-
-		key := strings.TrimSpace(parts[0])
-		value := strings.TrimSpace(parts[1])
-
-		unquotedVal, err := strconv.Unquote(value)
+		key, value, err := parseLine(line)
 		if err != nil {
-			unquotedVal = value
-			//errors = appendErrors(errors, fmt.Errorf("Error unquoting vmx value %s: %v.", value, err))
+			errors = appendErrors(errors, err)
+			continue
 		}
 
 		key = strings.ToLower(key)
-		d.vmx[key] = unquotedVal
+		d.vmx[key] = value
 	}
 
 	if err := d.scanner.Err(); err != nil {
@@ -84,6 +83,9 @@ func (d *Decoder) loadVMXMap() error {
 // optimize later if needed. Although, runtime complexities will vary depending
 // on the value type and whether there are nested fields in the reflect value.
 // However, the impact could be minimized by setting bounds to the recursion.
+//
+// Encrypted VMs decoded without EncryptionKey only get the keys stored in
+// plaintext and Decode returns ErrEncrypted.
 func (d *Decoder) Decode(v interface{}) error {
 	val := reflect.ValueOf(v)
 
@@ -107,7 +109,72 @@ func (d *Decoder) Decode(v interface{}) error {
 		return err
 	}
 
-	return d.decode(val, "")
+	encrypted, err := d.decryptVMXMap()
+	if err != nil {
+		return err
+	}
+
+	if err := d.decode(val, ""); err != nil {
+		return err
+	}
+
+	if encrypted && d.EncryptionKey == nil {
+		return ErrEncrypted
+	}
+	return nil
+}
+
+// Merges the decrypted configuration of encrypted VMs into the VMX map.
+// It reports whether the file is encrypted.
+func (d *Decoder) decryptVMXMap() (bool, error) {
+	data, found := d.vmx["encryption.data"]
+	if !found {
+		return false, nil
+	}
+
+	if d.EncryptionKey == nil {
+		return true, nil
+	}
+
+	plain, err := DecryptData(d.EncryptionKey, data)
+	if err != nil {
+		return true, err
+	}
+
+	// DecryptData can not always tell a wrong key, so the decrypted data
+	// is loaded apart and only merged if it is a valid VMX file.
+	inner := &Decoder{
+		scanner: bufio.NewScanner(bytes.NewReader(plain)),
+	}
+	if !utf8.Valid(plain) || inner.loadVMXMap() != nil || len(inner.vmx) == 0 {
+		return true, errors.New("Decrypted data is not a VMX file, wrong key?")
+	}
+
+	for k, v := range inner.vmx {
+		// The encrypted configuration must not replace the encryption
+		// settings it was decrypted with.
+		if k == "encryption.data" {
+			continue
+		}
+		d.vmx[k] = v
+	}
+	return true, nil
+}
+
+// Decodes values, indexed by VMX key, into the fields of the struct
+// pointed by v they map to. Fields without a matching key are left
+// untouched, which allows patching a value previously decoded.
+func decodeValues(values map[string]string, v interface{}) error {
+	val := reflect.ValueOf(v)
+	if val.Kind() != reflect.Ptr || val.IsNil() {
+		return errors.New("non-pointer value passed to decodeValues")
+	}
+
+	d := &Decoder{vmx: make(map[string]string, len(values))}
+	for k, value := range values {
+		d.vmx[strings.ToLower(k)] = value
+	}
+	return d.decode(val.Elem(), "")
 }
 
 // Lets decode only what the reflect value is asking for as opposed to starting
@@ -137,7 +204,7 @@ func (d *Decoder) decode(val reflect.Value, key string) error {
 			continue
 		}
 
-		destKey, _, _, err := parseTag(tag)
+		destKey, _, _, _, err := parseTag(tag)
 		if err != nil {
 			continue
 		}
@@ -175,6 +242,18 @@ func (d *Decoder) reflectKind(kind reflect.Kind, valueField reflect.Value, key s
 	value := d.vmx[key]
 	//fmt.Printf("%s => %s\n", key, value)
 
+	if valueField.CanAddr() {
+		if u, ok := valueField.Addr().Interface().(Unmarshaler); ok {
+			if value == "" {
+				if d.ErrorUnmatched {
+					return fmt.Errorf("Unmatched key found in Go type: %s", key)
+				}
+				return nil
+			}
+			return u.UnmarshalVMX(value)
+		}
+	}
+
 	if kind != reflect.Struct && kind != reflect.Array &&
 		kind != reflect.Slice && kind != reflect.Map {
 		if value == "" {
@@ -193,7 +272,8 @@ func (d *Decoder) reflectKind(kind reflect.Kind, valueField reflect.Value, key s
 		err = d.decodeSlice(valueField, key)
 
 	case reflect.Map:
-		// TODO(c4milo)
+		err = d.decodeMap(valueField, key)
+
 	case reflect.String:
 		valueField.SetString(value)
 
@@ -219,6 +299,27 @@ func (d *Decoder) reflectKind(kind reflect.Kind, valueField reflect.Value, key s
 	return err
 }
 
+// Decodes the keys under key into a map with string keys and values, such
+// as GuestInfo. Map keys are lowercased, like every VMX key.
+func (d *Decoder) decodeMap(valueField reflect.Value, key string) error {
+	t := valueField.Type()
+	if t.Key().Kind() != reflect.String || t.Elem().Kind() != reflect.String {
+		return fmt.Errorf("Data type unsupported: %s", t)
+	}
+
+	prefix := key + "."
+	for k, value := range d.vmx {
+		if !strings.HasPrefix(k, prefix) || len(k) == len(prefix) {
+			continue
+		}
+		if valueField.IsNil() {
+			valueField.Set(reflect.MakeMap(t))
+		}
+		valueField.SetMapIndex(reflect.ValueOf(k[len(prefix):]).Convert(t.Key()), reflect.ValueOf(value).Convert(t.Elem()))
+	}
+	return nil
+}
+
 func (d *Decoder) decodeSlice(valueField reflect.Value, key string) error {
 	//fmt.Printf("[D] Decode slice tagged as: ->%s<-\n", key)
 
@@ -21,6 +21,8 @@ func TestUnmarshal(t *testing.T) {
 	assert(t, vm.Vhardware.Version == 9, "vhwversion should be 9")
 	assert(t, len(vm.Ethernet) == 3, "there should be 3 ethernet devices")
 	assert(t, vm.NumvCPUs == 1, "there should be 1 vcpu")
+	equals(t, "core01.nvram", vm.NVRam)
+	equals(t, []string{"hdd", "cdrom"}, vm.BIOS.BootDevices())
 	// fmt.Printf("%+v\n", vm.IDEDevices)
 	// fmt.Printf("%+v\n", vm.SCSIDevices)
 	//fmt.Printf("%+v\n", vm.USBDevices)
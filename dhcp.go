@@ -0,0 +1,343 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+)
+
+// DHCPHost is a host declaration of a DHCP configuration, giving a fixed
+// address to a network adapter:
+//
+//	host core01 {
+//	    hardware ethernet 00:50:56:3a:4f:01;
+//	    fixed-address 192.168.100.10;
+//	}
+type DHCPHost struct {
+	Name             string
+	HardwareEthernet string
+	FixedAddress     string
+	// Other statements of the declaration, without their semicolon
+	Statements []string
+}
+
+func (h DHCPHost) String() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "host %s {\n", h.Name)
+	if h.HardwareEthernet != "" {
+		fmt.Fprintf(&b, "    hardware ethernet %s;\n", h.HardwareEthernet)
+	}
+	if h.FixedAddress != "" {
+		fmt.Fprintf(&b, "    fixed-address %s;\n", h.FixedAddress)
+	}
+	for _, s := range h.Statements {
+		fmt.Fprintf(&b, "    %s;\n", s)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// DHCPConfig is the configuration of the DHCP server of a virtual
+// network, dhcpd.conf on Linux and macOS hosts or vmnetdhcp.conf on
+// Windows. Only host declarations can be changed, the rest of the file is
+// written as it was read.
+type DHCPConfig struct {
+	// Subnet served, from the first subnet declaration
+	Subnet *net.IPNet
+	// Dynamically assigned addresses
+	RangeStart net.IP
+	RangeEnd   net.IP
+	Hosts      []*DHCPHost
+	// Text of the file, with host declarations in between
+	chunks []dhcpChunk
+}
+
+type dhcpChunk struct {
+	raw string
+	// Host declared by the chunk, if any, as it was read
+	host *DHCPHost
+}
+
+// ParseDHCPConfig parses a dhcpd.conf file.
+func ParseDHCPConfig(r io.Reader) (*DHCPConfig, error) {
+	config := new(DHCPConfig)
+
+	var raw bytes.Buffer
+	flush := func() {
+		if raw.Len() > 0 {
+			config.chunks = append(config.chunks, dhcpChunk{raw: raw.String()})
+			raw.Reset()
+		}
+	}
+
+	var errors []string
+	var host bytes.Buffer
+	hostLine := 0
+	depth, hostDepth := 0, 0
+	inSubnet := false
+
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		code := line
+		if i := strings.Index(code, "#"); i >= 0 {
+			code = code[:i]
+		}
+		code = strings.TrimSpace(code)
+		fields := strings.Fields(strings.TrimSuffix(strings.TrimSuffix(code, "{"), ";"))
+
+		if depth == 0 && len(fields) > 0 && fields[0] == "host" {
+			flush()
+			hostLine = lineNum
+			hostDepth = 0
+		}
+
+		if hostLine > 0 {
+			host.WriteString(line + "\n")
+			hostDepth += strings.Count(code, "{") - strings.Count(code, "}")
+			if hostDepth <= 0 && strings.Contains(host.String(), "}") {
+				h, err := parseDHCPHost(host.String())
+				if err != nil {
+					errors = append(errors, fmt.Sprintf("line %d: %v", hostLine, err))
+				} else {
+					config.Hosts = append(config.Hosts, &h)
+					original := h
+					original.Statements = append([]string{}, h.Statements...)
+					config.chunks = append(config.chunks, dhcpChunk{raw: host.String(), host: &original})
+				}
+				host.Reset()
+				hostLine = 0
+			}
+			continue
+		}
+
+		raw.WriteString(line + "\n")
+
+		switch {
+		case depth == 0 && len(fields) == 4 && fields[0] == "subnet" && fields[2] == "netmask" && config.Subnet == nil:
+			ip, mask := net.ParseIP(fields[1]).To4(), net.ParseIP(fields[3]).To4()
+			if ip == nil || mask == nil {
+				errors = append(errors, fmt.Sprintf("line %d: Invalid subnet: %s", lineNum, code))
+				break
+			}
+			config.Subnet = &net.IPNet{IP: ip, Mask: net.IPMask(mask)}
+			inSubnet = true
+		case inSubnet && depth == 1 && len(fields) == 3 && fields[0] == "range":
+			config.RangeStart, config.RangeEnd = net.ParseIP(fields[1]), net.ParseIP(fields[2])
+		}
+
+		depth += strings.Count(code, "{") - strings.Count(code, "}")
+		if depth == 0 {
+			inSubnet = false
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if hostLine > 0 {
+		errors = append(errors, fmt.Sprintf("line %d: Unterminated host declaration", hostLine))
+	}
+	if len(errors) > 0 {
+		return nil, &Error{errors}
+	}
+	flush()
+	return config, nil
+}
+
+func parseDHCPHost(text string) (DHCPHost, error) {
+	var code bytes.Buffer
+	for _, line := range strings.Split(text, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		code.WriteString(line + "\n")
+	}
+
+	s := code.String()
+	open, end := strings.Index(s, "{"), strings.LastIndex(s, "}")
+	if open < 0 || end < open {
+		return DHCPHost{}, fmt.Errorf("Invalid host declaration: %s", strings.TrimSpace(text))
+	}
+
+	h := DHCPHost{Name: strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(s[:open]), "host"))}
+	for _, statement := range strings.Split(s[open+1:end], ";") {
+		statement = strings.Join(strings.Fields(statement), " ")
+		switch {
+		case statement == "":
+		case strings.HasPrefix(statement, "hardware ethernet "):
+			h.HardwareEthernet = strings.TrimPrefix(statement, "hardware ethernet ")
+		case strings.HasPrefix(statement, "fixed-address "):
+			h.FixedAddress = strings.TrimPrefix(statement, "fixed-address ")
+		default:
+			h.Statements = append(h.Statements, statement)
+		}
+	}
+	return h, nil
+}
+
+// Host returns the declaration of the host with the given hardware
+// address, or nil.
+func (c *DHCPConfig) Host(mac string) *DHCPHost {
+	for _, h := range c.Hosts {
+		if strings.EqualFold(h.HardwareEthernet, mac) {
+			return h
+		}
+	}
+	return nil
+}
+
+// Bytes returns the contents of the file. Host declarations that did not
+// change are written as they were read, new ones are appended at the end.
+func (c *DHCPConfig) Bytes() []byte {
+	var b bytes.Buffer
+	written := make(map[int]bool)
+	for _, chunk := range c.chunks {
+		if chunk.host == nil {
+			b.WriteString(chunk.raw)
+			continue
+		}
+
+		for i, h := range c.Hosts {
+			if written[i] || h.Name != chunk.host.Name {
+				continue
+			}
+			written[i] = true
+			if reflect.DeepEqual(*h, *chunk.host) {
+				b.WriteString(chunk.raw)
+			} else {
+				b.WriteString(h.String())
+			}
+			break
+		}
+	}
+
+	for i, h := range c.Hosts {
+		if !written[i] {
+			b.WriteString(h.String())
+		}
+	}
+	return b.Bytes()
+}
+
+// Reservation is a fixed address given to a network adapter, along with
+// ports of the host forwarded to it.
+type Reservation struct {
+	// Name of the DHCP host declaration
+	Name string
+	MAC  string
+	IP   net.IP
+	// Ports forwarded to IP. Their GuestIP is set to IP.
+	PortForwards []PortForward
+}
+
+// NewReservation returns a reservation of ip for the adapter eth of vm,
+// which must have a static MAC address.
+func NewReservation(vm *VirtualMachine, eth Ethernet, ip net.IP, forwards ...PortForward) (*Reservation, error) {
+	if eth.Address == "" {
+		return nil, fmt.Errorf("%s has no static MAC address", eth.VMXID)
+	}
+
+	name := hostName(vm.DisplayName + "-" + eth.VMXID)
+	return &Reservation{Name: name, MAC: eth.Address, IP: ip, PortForwards: forwards}, nil
+}
+
+// Host names are identifiers in dhcpd.conf.
+func hostName(s string) string {
+	var b bytes.Buffer
+	for _, c := range s {
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_' {
+			b.WriteRune(c)
+		} else {
+			b.WriteByte('-')
+		}
+	}
+	return strings.Trim(b.String(), "-")
+}
+
+// Reserve adds the reservation to the DHCP and, if not nil, NAT
+// configuration, replacing any previous reservation for the same MAC
+// address. The address must belong to the subnet of the DHCP server and
+// be out of its dynamic range.
+func Reserve(dhcp *DHCPConfig, nat *NATConfig, r *Reservation) error {
+	ip := r.IP.To4()
+	if ip == nil {
+		return fmt.Errorf("Invalid IPv4 address: %v", r.IP)
+	}
+	if dhcp.Subnet != nil && !dhcp.Subnet.Contains(ip) {
+		return fmt.Errorf("%v is out of the DHCP subnet %v", ip, dhcp.Subnet)
+	}
+	if inRange(ip, dhcp.RangeStart, dhcp.RangeEnd) {
+		return fmt.Errorf("%v is within the dynamic range %v-%v", ip, dhcp.RangeStart, dhcp.RangeEnd)
+	}
+
+	for _, h := range dhcp.Hosts {
+		if h.FixedAddress == ip.String() && !strings.EqualFold(h.HardwareEthernet, r.MAC) {
+			return fmt.Errorf("%v is already reserved for %s", ip, h.HardwareEthernet)
+		}
+	}
+
+	if nat != nil {
+		for _, pf := range r.PortForwards {
+			existing := nat.PortForward(pf.Protocol, pf.HostPort)
+			if existing != nil && !existing.GuestIP.Equal(ip) && !isReservedBy(dhcp, existing.GuestIP, r.MAC) {
+				return fmt.Errorf("%s port %d is already forwarded to %v", pf.Protocol, pf.HostPort, existing.GuestIP)
+			}
+		}
+	}
+
+	Release(dhcp, nat, r.MAC)
+
+	dhcp.Hosts = append(dhcp.Hosts, &DHCPHost{Name: r.Name, HardwareEthernet: r.MAC, FixedAddress: ip.String()})
+	if nat != nil {
+		for _, pf := range r.PortForwards {
+			pf.GuestIP = ip
+			nat.AddPortForward(pf)
+		}
+	}
+	return nil
+}
+
+func isReservedBy(dhcp *DHCPConfig, ip net.IP, mac string) bool {
+	h := dhcp.Host(mac)
+	return h != nil && h.FixedAddress == ip.String()
+}
+
+// Release removes the fixed addresses of mac from the DHCP configuration
+// and, if not nil, the ports forwarded to them from the NAT configuration.
+// It reports whether a reservation was found.
+func Release(dhcp *DHCPConfig, nat *NATConfig, mac string) bool {
+	found := false
+	hosts := dhcp.Hosts[:0]
+	for _, h := range dhcp.Hosts {
+		if !strings.EqualFold(h.HardwareEthernet, mac) {
+			hosts = append(hosts, h)
+			continue
+		}
+
+		found = true
+		if ip := net.ParseIP(h.FixedAddress); nat != nil && ip != nil {
+			for _, pf := range nat.PortForwards() {
+				if pf.GuestIP.Equal(ip) {
+					nat.RemovePortForward(pf.Protocol, pf.HostPort)
+				}
+			}
+		}
+	}
+	dhcp.Hosts = hosts
+	return found
+}
+
+func inRange(ip, start, end net.IP) bool {
+	if start == nil || end == nil {
+		return false
+	}
+	return bytes.Compare(ip.To16(), start.To16()) >= 0 && bytes.Compare(ip.To16(), end.To16()) <= 0
+}
@@ -0,0 +1,124 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+const testDHCPConfig = `# Configuration file for ISC 2.0 vmnet-dhcpd operating on vmnet8.
+allow unknown-clients;
+default-lease-time 1800;                # default is 30 minutes
+max-lease-time 7200;                    # default is 2 hours
+
+subnet 192.168.100.0 netmask 255.255.255.0 {
+	range 192.168.100.128 192.168.100.254;
+	option broadcast-address 192.168.100.255;
+	option domain-name-servers 192.168.100.2;
+	option routers 192.168.100.2;
+}
+host vmnet8 {
+    hardware ethernet 00:50:56:C0:00:08;
+    fixed-address 192.168.100.1;
+    option domain-name-servers 0.0.0.0;
+}
+####### VMNET DHCP Configuration. End of "DO NOT MODIFY SECTION" #######
+`
+
+func TestParseDHCPConfig(t *testing.T) {
+	config, err := ParseDHCPConfig(strings.NewReader(testDHCPConfig))
+	ok(t, err)
+	equals(t, "192.168.100.0/24", config.Subnet.String())
+	equals(t, "192.168.100.128", config.RangeStart.String())
+	equals(t, "192.168.100.254", config.RangeEnd.String())
+
+	equals(t, 1, len(config.Hosts))
+	host := config.Host("00:50:56:c0:00:08")
+	equals(t, "vmnet8", host.Name)
+	equals(t, "192.168.100.1", host.FixedAddress)
+	equals(t, []string{"option domain-name-servers 0.0.0.0"}, host.Statements)
+
+	equals(t, testDHCPConfig, string(config.Bytes()))
+
+	_, err = ParseDHCPConfig(strings.NewReader("host core01 {\n    fixed-address 192.168.100.10;\n"))
+	assert(t, err != nil, "expected error for an unterminated host declaration")
+}
+
+func TestReserve(t *testing.T) {
+	dhcp, err := ParseDHCPConfig(strings.NewReader(testDHCPConfig))
+	ok(t, err)
+	nat, err := ParseNATConfig(strings.NewReader(testNATConfig))
+	ok(t, err)
+
+	vm := &VirtualMachine{DisplayName: "core01"}
+	eth := Ethernet{VMXID: "ethernet0", Address: "00:50:56:3a:4f:01"}
+	ssh := PortForward{Protocol: "tcp", HostPort: 2200, GuestPort: 22}
+	r, err := NewReservation(vm, eth, net.ParseIP("192.168.100.10"), ssh)
+	ok(t, err)
+	equals(t, "core01-ethernet0", r.Name)
+
+	ok(t, Reserve(dhcp, nat, r))
+	host := dhcp.Host("00:50:56:3A:4F:01")
+	equals(t, "192.168.100.10", host.FixedAddress)
+	pf := nat.PortForward("tcp", 2200)
+	equals(t, "192.168.100.10", pf.GuestIP.String())
+	equals(t, 22, pf.GuestPort)
+
+	want := testDHCPConfig + `host core01-ethernet0 {
+    hardware ethernet 00:50:56:3a:4f:01;
+    fixed-address 192.168.100.10;
+}
+`
+	equals(t, want, string(dhcp.Bytes()))
+
+	// Hosts returned by Host remain part of the configuration as others
+	// are added.
+	ok(t, Reserve(dhcp, nil, &Reservation{Name: "core02", MAC: "00:50:56:3a:4f:02", IP: net.ParseIP("192.168.100.20")}))
+	assert(t, dhcp.Host(eth.Address) == host, "expected the same host for %s", eth.Address)
+	assert(t, Release(dhcp, nil, "00:50:56:3a:4f:02"), "expected the reservation of core02 to be released")
+
+	// Reserving again moves the reservation.
+	r.IP = net.ParseIP("192.168.100.11")
+	ok(t, Reserve(dhcp, nat, r))
+	equals(t, 2, len(dhcp.Hosts))
+	equals(t, "192.168.100.11", nat.PortForward("tcp", 2200).GuestIP.String())
+
+	assert(t, Release(dhcp, nat, eth.Address), "expected the reservation to be released")
+	assert(t, dhcp.Host(eth.Address) == nil, "expected no host for %s", eth.Address)
+	assert(t, nat.PortForward("tcp", 2200) == nil, "expected no forward of port 2200")
+	equals(t, testDHCPConfig, string(dhcp.Bytes()))
+	assert(t, !Release(dhcp, nat, eth.Address), "expected nothing to release")
+
+	_, err = NewReservation(vm, Ethernet{VMXID: "ethernet1"}, net.ParseIP("192.168.100.12"))
+	assert(t, err != nil, "expected error for an adapter without static MAC address")
+}
+
+func TestReserveErrors(t *testing.T) {
+	dhcp, err := ParseDHCPConfig(strings.NewReader(testDHCPConfig))
+	ok(t, err)
+	nat, err := ParseNATConfig(strings.NewReader(testNATConfig))
+	ok(t, err)
+
+	reservation := func(ip string, forwards ...PortForward) *Reservation {
+		return &Reservation{Name: "core01", MAC: "00:50:56:3a:4f:01", IP: net.ParseIP(ip), PortForwards: forwards}
+	}
+
+	tests := []struct {
+		name string
+		r    *Reservation
+	}{
+		{"out of subnet", reservation("10.0.0.10")},
+		{"dynamic range", reservation("192.168.100.130")},
+		{"reserved address", reservation("192.168.100.1")},
+		{"forwarded port", reservation("192.168.100.10", PortForward{Protocol: "tcp", HostPort: 8080, GuestPort: 80})},
+	}
+	for _, tt := range tests {
+		err := Reserve(dhcp, nat, tt.r)
+		assert(t, err != nil, "%s: expected error", tt.name)
+	}
+	equals(t, testDHCPConfig, string(dhcp.Bytes()))
+	equals(t, testNATConfig, string(nat.Bytes()))
+}
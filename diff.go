@@ -0,0 +1,210 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Operation describes how a key changed between two documents. Values
+// match the operations of a JSON patch (RFC 6902).
+type Operation string
+
+const (
+	Added    Operation = "add"
+	Removed  Operation = "remove"
+	Modified Operation = "replace"
+)
+
+// Change is a key whose effective value differs between two documents.
+type Change struct {
+	Op Operation
+	// Key as written in the newest document that has it.
+	Key string
+	// Key as written in the old document, empty for added keys. JSON
+	// patches use it, as they apply to the old document.
+	OldKey string
+	// Device the key belongs to, such as ethernet1, scsi0:2 or
+	// sharedfolder0. Empty for keys that are not part of a device.
+	Device string
+	Old    string
+	New    string
+}
+
+// Changes is the result of comparing two documents, sorted by device and key.
+type Changes []Change
+
+// Matches the first segment of a key when it names a device instance:
+// ethernet0, scsi0:1, usb:0, sharedFolder2, etc.
+var deviceRe = regexp.MustCompile(`^([a-z]+[0-9]+(:[0-9]+)?|[a-z]+:[0-9]+)$`)
+
+// DeviceOf returns the lowercased device a key belongs to, or an empty
+// string if the key is not part of a device.
+//
+// Examples:
+//   - ethernet1.virtualDev belongs to ethernet1
+//   - scsi0:2.fileName belongs to scsi0:2
+//   - memsize does not belong to any device
+func DeviceOf(key string) string {
+	key = strings.ToLower(key)
+	i := strings.Index(key, ".")
+	if i < 0 {
+		return ""
+	}
+	if prefix := key[:i]; deviceRe.MatchString(prefix) {
+		return prefix
+	}
+	return ""
+}
+
+// Diff compares the effective key/values of a and b. Keys are compared
+// case-insensitively and so are boolean values, meaning that "TRUE" and
+// "true" are considered equal.
+func Diff(a, b *Document) Changes {
+	oldKeys, oldValues := effectiveEntries(a)
+	newKeys, newValues := effectiveEntries(b)
+
+	var changes Changes
+	for k, oldValue := range oldValues {
+		newValue, found := newValues[k]
+		switch {
+		case !found:
+			changes = append(changes, Change{Op: Removed, Key: oldKeys[k], OldKey: oldKeys[k], Old: oldValue})
+		case !equalValues(oldValue, newValue):
+			changes = append(changes, Change{Op: Modified, Key: newKeys[k], OldKey: oldKeys[k], Old: oldValue, New: newValue})
+		}
+	}
+
+	for k, newValue := range newValues {
+		if _, found := oldValues[k]; !found {
+			changes = append(changes, Change{Op: Added, Key: newKeys[k], New: newValue})
+		}
+	}
+
+	for i := range changes {
+		changes[i].Device = DeviceOf(changes[i].Key)
+	}
+
+	sort.Sort(changes)
+	return changes
+}
+
+// Returns the effective values of doc, along with the key casing used in
+// the file, both indexed by lowercased key.
+func effectiveEntries(doc *Document) (map[string]string, map[string]string) {
+	keys := make(map[string]string)
+	values := make(map[string]string)
+	if doc == nil {
+		return keys, values
+	}
+
+	for _, e := range doc.Entries() {
+		k := strings.ToLower(e.Key)
+		keys[k] = e.Key
+		values[k] = e.Value
+	}
+	return keys, values
+}
+
+// Compares two values the way VMware does: booleans are case-insensitive.
+func equalValues(a, b string) bool {
+	if a == b {
+		return true
+	}
+	return strings.EqualFold(a, b) && isBoolValue(a)
+}
+
+func isBoolValue(s string) bool {
+	switch strings.ToLower(s) {
+	case "true", "false":
+		return true
+	}
+	return false
+}
+
+func (c Changes) Len() int      { return len(c) }
+func (c Changes) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c Changes) Less(i, j int) bool {
+	if c[i].Device != c[j].Device {
+		return c[i].Device < c[j].Device
+	}
+	return strings.ToLower(c[i].Key) < strings.ToLower(c[j].Key)
+}
+
+// Devices returns the devices affected by the changes, in order.
+func (c Changes) Devices() []string {
+	var devices []string
+	seen := make(map[string]bool)
+	for _, change := range c {
+		if change.Device != "" && !seen[change.Device] {
+			seen[change.Device] = true
+			devices = append(devices, change.Device)
+		}
+	}
+	return devices
+}
+
+// String renders the changes for humans, one line per key, grouped
+// under a header for each device:
+//
+//	~ memsize = "1024" -> "2048"
+//	[ethernet1]
+//	+ ethernet1.address = "00:50:56:aa:bb:cc"
+//	- ethernet1.generatedAddress = "00:0c:29:20:41:a3"
+func (c Changes) String() string {
+	var b bytes.Buffer
+	device := ""
+	for _, change := range c {
+		if change.Device != device {
+			device = change.Device
+			fmt.Fprintf(&b, "[%s]\n", device)
+		}
+
+		switch change.Op {
+		case Added:
+			fmt.Fprintf(&b, "+ %s\n", formatEntry(change.Key, change.New))
+		case Removed:
+			fmt.Fprintf(&b, "- %s\n", formatEntry(change.Key, change.Old))
+		case Modified:
+			fmt.Fprintf(&b, "~ %s -> \"%s\"\n", formatEntry(change.Key, change.Old), escapeValue(change.New))
+		}
+	}
+	return b.String()
+}
+
+type patchOperation struct {
+	Op    Operation `json:"op"`
+	Path  string    `json:"path"`
+	Value *string   `json:"value,omitempty"`
+}
+
+// JSONPatch renders the changes as a JSON patch (RFC 6902) against an
+// object with one member per VMX key of the old document. Keys modified or
+// removed keep the casing of the old document, so that the patch applies
+// to it even if the new one changed their casing.
+func (c Changes) JSONPatch() ([]byte, error) {
+	escaper := strings.NewReplacer("~", "~0", "/", "~1")
+
+	ops := make([]patchOperation, len(c))
+	for i, change := range c {
+		key := change.Key
+		if change.OldKey != "" {
+			key = change.OldKey
+		}
+		ops[i] = patchOperation{
+			Op:   change.Op,
+			Path: "/" + escaper.Replace(key),
+		}
+		if change.Op != Removed {
+			value := change.New
+			ops[i].Value = &value
+		}
+	}
+	return json.MarshalIndent(ops, "", "  ")
+}
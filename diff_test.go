@@ -0,0 +1,115 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDeviceOf(t *testing.T) {
+	tests := []struct {
+		key    string
+		device string
+	}{
+		{"ethernet1.virtualDev", "ethernet1"},
+		{"scsi0:2.fileName", "scsi0:2"},
+		{"scsi0.present", "scsi0"},
+		{"usb:1.deviceType", "usb:1"},
+		{"sharedFolder0.hostPath", "sharedfolder0"},
+		{"memsize", ""},
+		{"virtualHW.version", ""},
+		{".encoding", ""},
+	}
+
+	for _, tt := range tests {
+		equals(t, tt.device, DeviceOf(tt.key))
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a, err := ParseDocument(strings.NewReader(`memsize = "1024"
+cleanShutdown = "TRUE"
+ethernet1.virtualDev = "e1000"
+ethernet1.generatedAddress = "00:0c:29:20:41:a3"
+scsi0:2.fileName = "disk.vmdk"
+`))
+	ok(t, err)
+
+	b, err := ParseDocument(strings.NewReader(`CLEANSHUTDOWN = "true"
+ethernet1.virtualDev = "vmxnet3"
+ethernet1.address = "00:50:56:aa:bb:cc"
+MemSize = "2048"
+scsi0:2.filename = "disk.vmdk"
+`))
+	ok(t, err)
+
+	changes := Diff(a, b)
+	equals(t, Changes{
+		{Op: Modified, Key: "MemSize", OldKey: "memsize", Old: "1024", New: "2048"},
+		{Op: Added, Key: "ethernet1.address", Device: "ethernet1", New: "00:50:56:aa:bb:cc"},
+		{Op: Removed, Key: "ethernet1.generatedAddress", OldKey: "ethernet1.generatedAddress", Device: "ethernet1", Old: "00:0c:29:20:41:a3"},
+		{Op: Modified, Key: "ethernet1.virtualDev", OldKey: "ethernet1.virtualDev", Device: "ethernet1", Old: "e1000", New: "vmxnet3"},
+	}, changes)
+	equals(t, []string{"ethernet1"}, changes.Devices())
+
+	equals(t, `~ MemSize = "1024" -> "2048"
+[ethernet1]
++ ethernet1.address = "00:50:56:aa:bb:cc"
+- ethernet1.generatedAddress = "00:0c:29:20:41:a3"
+~ ethernet1.virtualDev = "e1000" -> "vmxnet3"
+`, changes.String())
+
+	patch, err := changes.JSONPatch()
+	ok(t, err)
+	equals(t, `[
+  {
+    "op": "replace",
+    "path": "/memsize",
+    "value": "2048"
+  },
+  {
+    "op": "add",
+    "path": "/ethernet1.address",
+    "value": "00:50:56:aa:bb:cc"
+  },
+  {
+    "op": "remove",
+    "path": "/ethernet1.generatedAddress"
+  },
+  {
+    "op": "replace",
+    "path": "/ethernet1.virtualDev",
+    "value": "vmxnet3"
+  }
+]`, string(patch))
+
+	// The patch applies to the old document, despite the new casing of
+	// MemSize.
+	object := make(map[string]string)
+	for _, e := range a.Entries() {
+		object[e.Key] = e.Value
+	}
+	var ops []patchOperation
+	ok(t, json.Unmarshal(patch, &ops))
+	for _, op := range ops {
+		key := strings.TrimPrefix(op.Path, "/")
+		_, found := object[key]
+		switch op.Op {
+		case Added:
+			object[key] = *op.Value
+		case Modified:
+			assert(t, found, "replace of missing member %s", op.Path)
+			object[key] = *op.Value
+		case Removed:
+			assert(t, found, "remove of missing member %s", op.Path)
+			delete(object, key)
+		}
+	}
+	equals(t, "2048", object["memsize"])
+	equals(t, "vmxnet3", object["ethernet1.virtualDev"])
+
+	equals(t, 0, len(Diff(a, a)))
+}
@@ -0,0 +1,380 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+)
+
+// Entry is a single key/value pair found in a VMX file.
+type Entry struct {
+	// Key as written in the file, casing included.
+	Key string
+	// Unescaped value.
+	Value string
+	// Line number where the entry was found, starting at 1. It is 0
+	// for entries added after the document was parsed.
+	Line int
+}
+
+// Document is a raw, ordered representation of a VMX file. Unlike
+// Unmarshal, it keeps every line of the file, comments included, so that
+// editing a single key writes the rest of the file back untouched.
+//
+// Keys are matched case-insensitively, the same way VMware does.
+type Document struct {
+	lines []docLine
+	// Line separator found in the source, "\n" unless the file used CRLF.
+	newline string
+}
+
+type docLine struct {
+	Entry
+	// Original text of the line. Comments and blank lines are always
+	// written back verbatim, entries only until they are modified.
+	raw     string
+	isEntry bool
+	dirty   bool
+}
+
+// ParseDocument reads a VMX file from r. Lines that are neither comments
+// nor valid key/value pairs are reported in an *Error, along with their
+// line numbers.
+func ParseDocument(r io.Reader) (*Document, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	d := new(Document)
+	text := string(data)
+	if strings.Contains(text, "\r\n") {
+		d.newline = "\r\n"
+		text = strings.Replace(text, "\r\n", "\n", -1)
+	}
+	text = strings.TrimSuffix(text, "\n")
+
+	if text == "" {
+		return d, nil
+	}
+
+	var errors []string
+	for i, raw := range strings.Split(text, "\n") {
+		l := docLine{raw: raw}
+		if !isBlankOrComment(raw) {
+			key, value, err := parseLine(raw)
+			if err != nil {
+				errors = append(errors, fmt.Sprintf("line %d: %v", i+1, err))
+			} else {
+				l.isEntry = true
+				l.Entry = Entry{Key: key, Value: value, Line: i + 1}
+			}
+		}
+		d.lines = append(d.lines, l)
+	}
+
+	if len(errors) > 0 {
+		return nil, &Error{errors}
+	}
+	return d, nil
+}
+
+// Get returns the value of key. If the key appears more than once,
+// the last value wins, as it does for VMware.
+func (d *Document) Get(key string) (string, bool) {
+	e, found := d.entry(key)
+	return e.Value, found
+}
+
+// Returns the effective entry for key, the last one in the file.
+func (d *Document) entry(key string) (Entry, bool) {
+	for i := len(d.lines) - 1; i >= 0; i-- {
+		l := d.lines[i]
+		if l.isEntry && strings.EqualFold(l.Key, key) {
+			return l.Entry, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Set changes the value of key, keeping its position and casing in the
+// file. Keys not yet present are appended at the end of the document.
+func (d *Document) Set(key, value string) {
+	found := false
+	for i := range d.lines {
+		l := &d.lines[i]
+		if l.isEntry && strings.EqualFold(l.Key, key) {
+			found = true
+			if l.Value != value {
+				l.Value = value
+				l.dirty = true
+			}
+		}
+	}
+
+	if !found {
+		d.lines = append(d.lines, docLine{
+			Entry:   Entry{Key: key, Value: value},
+			isEntry: true,
+			dirty:   true,
+		})
+	}
+}
+
+// Unset removes every occurrence of key and reports whether it was found.
+func (d *Document) Unset(key string) bool {
+	found := false
+	lines := d.lines[:0]
+	for _, l := range d.lines {
+		if l.isEntry && strings.EqualFold(l.Key, key) {
+			found = true
+			continue
+		}
+		lines = append(lines, l)
+	}
+	d.lines = lines
+	return found
+}
+
+// Decode decodes the document into the Go value pointed by v. See
+// Unmarshal.
+func (d *Document) Decode(v interface{}) error {
+	return Unmarshal(d.Bytes(), v)
+}
+
+// Update sets in the document the keys of the fields of the struct
+// pointed by v whose value differs from the one in the document. Fields
+// set to their zero value and omitted when encoding remove their key.
+// Keys that are not mapped to fields of v are left untouched, which makes
+// it safe to update files with settings v does not know about.
+func (d *Document) Update(v interface{}) error {
+	val := reflect.ValueOf(v)
+	if val.Kind() != reflect.Ptr || val.IsNil() {
+		return errors.New("non-pointer value passed to Update")
+	}
+
+	current := reflect.New(val.Elem().Type())
+	if err := d.Decode(current.Interface()); err != nil {
+		return err
+	}
+
+	before, err := marshalEntries(current.Interface())
+	if err != nil {
+		return err
+	}
+	after, err := marshalEntries(v)
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string]string, len(before))
+	for _, e := range before {
+		values[strings.ToLower(e.Key)] = e.Value
+	}
+
+	updated := make(map[string]bool, len(after))
+	for _, e := range after {
+		key := strings.ToLower(e.Key)
+		updated[key] = true
+		if old, found := values[key]; !found || !equalValues(old, e.Value) {
+			d.Set(e.Key, formatValue(e.Value))
+		}
+	}
+
+	for _, e := range before {
+		if !updated[strings.ToLower(e.Key)] {
+			d.Unset(e.Key)
+		}
+	}
+	return nil
+}
+
+func marshalEntries(v interface{}) ([]Entry, error) {
+	data, err := Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := ParseDocument(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return doc.Entries(), nil
+}
+
+// Copy returns a deep copy of the document.
+func (d *Document) Copy() *Document {
+	c := &Document{newline: d.newline}
+	c.lines = append(c.lines, d.lines...)
+	return c
+}
+
+// Entries returns all the key/value pairs of the document in the order
+// they appear, duplicates included.
+func (d *Document) Entries() []Entry {
+	var entries []Entry
+	for _, l := range d.lines {
+		if l.isEntry {
+			entries = append(entries, l.Entry)
+		}
+	}
+	return entries
+}
+
+// Returns the last occurrence of every key, in file order.
+func (d *Document) uniqueEntries() []Entry {
+	last := make(map[string]int)
+	entries := d.Entries()
+	for i, e := range entries {
+		last[strings.ToLower(e.Key)] = i
+	}
+
+	unique := entries[:0]
+	for i, e := range entries {
+		if last[strings.ToLower(e.Key)] == i {
+			unique = append(unique, e)
+		}
+	}
+	return unique
+}
+
+// Map returns the effective value of every key in the document. Keys are
+// lowercased and duplicates resolved the way VMware does, last one wins.
+func (d *Document) Map() map[string]string {
+	m := make(map[string]string)
+	for _, l := range d.lines {
+		if l.isEntry {
+			m[strings.ToLower(l.Key)] = l.Value
+		}
+	}
+	return m
+}
+
+// Len returns the number of key/value pairs in the document.
+func (d *Document) Len() int {
+	n := 0
+	for _, l := range d.lines {
+		if l.isEntry {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteTo writes the document to w in VMX format.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	newline := d.newline
+	if newline == "" {
+		newline = "\n"
+	}
+
+	var b bytes.Buffer
+	for _, l := range d.lines {
+		if l.isEntry && (l.dirty || l.raw == "") {
+			b.WriteString(formatEntry(l.Key, l.Value))
+		} else {
+			b.WriteString(l.raw)
+		}
+		b.WriteString(newline)
+	}
+	return b.WriteTo(w)
+}
+
+// Bytes returns the document in VMX format.
+func (d *Document) Bytes() []byte {
+	var b bytes.Buffer
+	d.WriteTo(&b)
+	return b.Bytes()
+}
+
+func (d *Document) String() string {
+	return string(d.Bytes())
+}
+
+func isBlankOrComment(line string) bool {
+	line = strings.TrimSpace(line)
+	return line == "" || strings.HasPrefix(line, "#")
+}
+
+// Parses a single key = "value" line. Values are usually double quoted,
+// although VMware also accepts bare values such as rtc.diffFromUTC = 0.
+func parseLine(line string) (string, string, error) {
+	i := strings.Index(line, "=")
+	if i < 0 {
+		return "", "", fmt.Errorf("Invalid line: %s", line)
+	}
+
+	key := strings.TrimSpace(line[:i])
+	value := strings.TrimSpace(line[i+1:])
+	if key == "" {
+		return "", "", fmt.Errorf("Missing key: %s", line)
+	}
+
+	if strings.HasPrefix(value, `"`) {
+		if len(value) < 2 || !strings.HasSuffix(value, `"`) {
+			return "", "", fmt.Errorf("Unterminated value: %s", line)
+		}
+		value = value[1 : len(value)-1]
+	}
+
+	return key, unescapeValue(value), nil
+}
+
+// Renders a key/value pair the way VMware writes it.
+func formatEntry(key, value string) string {
+	return fmt.Sprintf("%s = \"%s\"", key, escapeValue(value))
+}
+
+// VMware escapes special characters in values as a pipe followed by the
+// two hex digits of the byte. For instance, a double quote is stored as
+// |22 and a new line as |0A.
+func escapeValue(s string) string {
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c == 0x7f || c == '"' || c == '#' || c == '|' {
+			fmt.Fprintf(&b, "|%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+func unescapeValue(s string) string {
+	if !strings.Contains(s, "|") {
+		return s
+	}
+
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if s[i] == '|' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			b.WriteByte(unhex(s[i+1])<<4 | unhex(s[i+2]))
+			i += 2
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
@@ -0,0 +1,75 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDocumentRoundTrip(t *testing.T) {
+	for _, name := range []string{"a.vmx", "b.vmx"} {
+		data, err := ioutil.ReadFile(filepath.Join(".", "fixtures", name))
+		ok(t, err)
+
+		doc, err := ParseDocument(bytes.NewReader(data))
+		ok(t, err)
+		equals(t, string(data), doc.String())
+	}
+}
+
+func TestDocumentEdit(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join(".", "fixtures", "a.vmx"))
+	ok(t, err)
+
+	doc, err := ParseDocument(bytes.NewReader(data))
+	ok(t, err)
+
+	value, found := doc.Get("DISPLAYNAME")
+	assert(t, found, "displayName should be found")
+	equals(t, "coreos_production_vmware-410-0-0", value)
+
+	value, found = doc.Get("rtc.diffFromUTC")
+	assert(t, found, "rtc.diffFromUTC should be found")
+	equals(t, "0", value)
+
+	doc.Set("displayname", "core02")
+	doc.Set("annotation", `Say "hi"|bye`)
+	assert(t, doc.Unset("floppy0.present"), "floppy0.present should be removed")
+	assert(t, !doc.Unset("floppy0.present"), "floppy0.present was already removed")
+
+	expected := strings.Replace(string(data), `displayName = "coreos_production_vmware-410-0-0"`, `displayName = "core02"`, 1)
+	expected = strings.Replace(expected, "floppy0.present = \"FALSE\"\n", "", 1)
+	expected += "annotation = \"Say |22hi|22|7Cbye\"\n"
+	equals(t, expected, doc.String())
+
+	doc, err = ParseDocument(strings.NewReader(doc.String()))
+	ok(t, err)
+	value, _ = doc.Get("annotation")
+	equals(t, `Say "hi"|bye`, value)
+}
+
+func TestDocumentErrors(t *testing.T) {
+	_, err := ParseDocument(strings.NewReader("# comment\nmemsize = \"1024\"\nnumvcpus\n = \"2\"\nguestos = \"other\n"))
+	assert(t, err != nil, "an error was expected")
+
+	e, isError := err.(*Error)
+	assert(t, isError, "error should be of type *Error")
+	equals(t, []string{
+		"line 3: Invalid line: numvcpus",
+		`line 4: Missing key:  = "2"`,
+		`line 5: Unterminated value: guestos = "other`,
+	}, e.Errors)
+}
+
+func TestDocumentCRLF(t *testing.T) {
+	doc, err := ParseDocument(strings.NewReader(".encoding = \"UTF-8\"\r\nmemsize = \"1024\"\r\n"))
+	ok(t, err)
+
+	doc.Set("numvcpus", "2")
+	equals(t, ".encoding = \"UTF-8\"\r\nmemsize = \"1024\"\r\nnumvcpus = \"2\"\r\n", doc.String())
+}
@@ -5,8 +5,10 @@ package vmx
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
 )
 
@@ -20,6 +22,19 @@ type Encoder struct {
 	// Parent key, used for recursion. This will allow us to set the correct
 	// keys for nested structures.
 	parentKey string
+
+	// Replace the values of fields tagged as secret with RedactedValue
+	Redact bool
+}
+
+// Value written instead of secrets when redaction is enabled.
+const RedactedValue = "[REDACTED]"
+
+// encodePreparer is implemented by types that need to adjust their
+// fields right before being encoded. The returned value is encoded
+// instead of the original one.
+type encodePreparer interface {
+	prepareEncode() (interface{}, error)
 }
 
 // Creates a new encoder
@@ -30,10 +45,15 @@ func NewEncoder(buffer *bytes.Buffer) *Encoder {
 	}
 }
 
-// Encodes Go structure into a VMX structure, recursively.
+// Encodes Go structure into a VMX structure, recursively. Encrypted VMs
+// can only be encoded with redaction enabled: writing their configuration
+// in plaintext would leak it, and re-encrypting it is not supported since
+// VMware may not open the result. See DecryptData.
 func (e *Encoder) Encode(v interface{}) error {
-	val := reflect.ValueOf(v)
-	return e.encode(val)
+	if vm, ok := v.(interface{ Encrypted() bool }); ok && vm.Encrypted() && !e.Redact {
+		return errors.New("encoding encrypted VMs is not supported")
+	}
+	return e.encode(reflect.ValueOf(v))
 }
 
 // Does the actual encoding work
@@ -48,38 +68,56 @@ func (e *Encoder) encode(val reflect.Value) error {
 		val = val.Elem()
 	}
 
+	if p, ok := val.Interface().(encodePreparer); ok {
+		prepared, err := p.prepareEncode()
+		if err != nil {
+			return err
+		}
+		val = reflect.ValueOf(prepared)
+	}
+
 	for i := 0; i < val.NumField(); i++ {
 		valueField := val.Field(i)
 		typeField := val.Type().Field(i)
 
 		tag := typeField.Tag
 
-		key, omitempty, omit, err := parseTag(string(tag))
+		key, omitempty, omit, secret, err := parseTag(string(tag))
 		if err != nil {
 			return err
 		}
 
-		if key == "-" || !valueField.IsValid() ||
-			omitempty && isEmptyValue(valueField) ||
-			omit ||
+		if key == "-" || !valueField.IsValid() || omit ||
 			key == "" && !typeField.Anonymous {
 			continue
 		}
 
+		if m, ok := marshaler(valueField); ok {
+			value, err := m.MarshalVMX()
+			if err != nil {
+				return err
+			}
+			if omitempty && value == "" {
+				continue
+			}
+			e.writeEntry(key, value, secret)
+			continue
+		}
+
+		if omitempty && isEmptyValue(valueField) {
+			continue
+		}
+
 		kind := valueField.Kind()
 		switch kind {
 		case reflect.Struct:
 			err = e.encodeStruct(valueField, typeField, key)
 		case reflect.Array, reflect.Slice:
 			err = e.encodeArray(valueField, key)
+		case reflect.Map:
+			e.encodeMap(valueField, key, secret)
 		default:
-			if e.parentKey != "" {
-				key = e.parentKey + "." + key
-			}
-
-			//fmt.Printf("parent key: %s, key: %s \n", e.parentKey, key)
-			value := valueField.Interface()
-			e.buffer.WriteString(fmt.Sprintf("%s = \"%v\"\n", key, value))
+			e.writeEntry(key, fmt.Sprint(valueField.Interface()), secret)
 		}
 
 		if err != nil {
@@ -90,6 +128,27 @@ func (e *Encoder) encode(val reflect.Value) error {
 	return nil
 }
 
+// Returns the Marshaler implemented by v, if any.
+func marshaler(v reflect.Value) (Marshaler, bool) {
+	if !v.CanInterface() {
+		return nil, false
+	}
+	m, ok := v.Interface().(Marshaler)
+	return m, ok
+}
+
+// Writes the entry of a field, prefixed by the key of its parent.
+func (e *Encoder) writeEntry(key, value string, secret bool) {
+	if e.parentKey != "" {
+		key = e.parentKey + "." + key
+	}
+
+	if secret && e.Redact && value != "" {
+		value = RedactedValue
+	}
+	e.buffer.WriteString(formatEntry(key, value) + "\n")
+}
+
 // When an array or slice type is found in the Go structure, this function encodes it
 // recursively.
 func (e *Encoder) encodeArray(valueField reflect.Value, key string) error {
@@ -164,6 +223,34 @@ func (e *Encoder) encodeArray(valueField reflect.Value, key string) error {
 	return nil
 }
 
+// Encodes the entries of a map as keys under key, sorted so that the
+// output is stable.
+func (e *Encoder) encodeMap(valueField reflect.Value, key string, secret bool) {
+	keys := valueField.MapKeys()
+	names := make([]string, len(keys))
+	for i, k := range keys {
+		names[i] = fmt.Sprint(k.Interface())
+	}
+	sort.Sort(byName{names, keys})
+
+	for i, k := range keys {
+		e.writeEntry(key+"."+names[i], fmt.Sprint(valueField.MapIndex(k).Interface()), secret)
+	}
+}
+
+// Sorts map keys by their name.
+type byName struct {
+	names []string
+	keys  []reflect.Value
+}
+
+func (s byName) Len() int           { return len(s.names) }
+func (s byName) Less(i, j int) bool { return s.names[i] < s.names[j] }
+func (s byName) Swap(i, j int) {
+	s.names[i], s.names[j] = s.names[j], s.names[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
+
 // Encodes a Go struct type into a VMX string, recursively.
 func (e *Encoder) encodeStruct(valueField reflect.Value, typeField reflect.StructField, key string) error {
 	e.currentRecursion++
@@ -11,27 +11,31 @@ func TestParsingTag(t *testing.T) {
 		name      string
 		omitempty bool
 		omit      bool
+		secret    bool
 		err       string
 	}{
-		{"vmx:displayname", "", false, false, "Tag name has to be enclosed in double quotes: vmx:displayname"},
-		{"vmx:", "", false, false, "Invalid tag: vmx:"},
-		{`vmx:""`, "", false, false, `Tag name is missing: vmx:""`},
-		{"vm", "", false, false, "Invalid tag: vm"},
-		{`vmx:"displayname1,omitempty`, "displayname1", true, false, ""},
-		{`vmx:"displayname2"`, "displayname2", false, false, ""},
-		{`vmx:"-"`, "-", false, false, ""},
-		{`vmx:"displayname3,omit`, "displayname3", false, true, ""},
-		{`vmx:"displayname4,omitempty,omit`, "displayname4", true, true, ""},
-		{`vmx:"displayname5,omit,omitempty`, "displayname5", true, true, ""},
-		{`vmx:"displayname6,omit , omitempty`, "displayname6", true, true, ""},
-		{`vmx:"displayname7 , omit , omitempty `, "displayname7", true, true, ""},
+		{"vmx:displayname", "", false, false, false, "Tag name has to be enclosed in double quotes: vmx:displayname"},
+		{"vmx:", "", false, false, false, "Invalid tag: vmx:"},
+		{`vmx:""`, "", false, false, false, `Tag name is missing: vmx:""`},
+		{"vm", "", false, false, false, "Invalid tag: vm"},
+		{`vmx:"displayname1,omitempty`, "displayname1", true, false, false, ""},
+		{`vmx:"displayname2"`, "displayname2", false, false, false, ""},
+		{`vmx:"-"`, "-", false, false, false, ""},
+		{`vmx:"displayname3,omit`, "displayname3", false, true, false, ""},
+		{`vmx:"displayname4,omitempty,omit`, "displayname4", true, true, false, ""},
+		{`vmx:"displayname5,omit,omitempty`, "displayname5", true, true, false, ""},
+		{`vmx:"displayname6,omit , omitempty`, "displayname6", true, true, false, ""},
+		{`vmx:"displayname7 , omit , omitempty `, "displayname7", true, true, false, ""},
+		{`vmx:"vnc.password,omitempty,secret"`, "vnc.password", true, false, true, ""},
+		{`vmx:"vnc.password,hidden"`, "vnc.password", false, false, false, "Unknown option: hidden"},
 	}
 
 	for _, tt := range tests {
-		name, omitempty, omit, err := parseTag(tt.tag)
+		name, omitempty, omit, secret, err := parseTag(tt.tag)
 		equals(t, tt.name, name)
 		equals(t, tt.omitempty, omitempty)
 		equals(t, tt.omit, omit)
+		equals(t, tt.secret, secret)
 		if err != nil {
 			equals(t, tt.err, err.Error())
 		} else {
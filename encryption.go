@@ -0,0 +1,344 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+// ErrEncrypted is returned when decoding an encrypted VM without its
+// key. Keys stored in plaintext, such as the display name and the key
+// safe, are still decoded.
+var ErrEncrypted = errors.New("VMX file is encrypted, an encryption key is required to decode it")
+
+// Encrypted reports whether the VM configuration is encrypted.
+func (vm VirtualMachine) Encrypted() bool {
+	return vm.Encryption.Data != ""
+}
+
+// KeySafe is the parsed form of encryption.keySafe. It lists the ways
+// the key of the VM can be obtained, for instance from a passphrase or
+// from a key management server.
+//
+//	vmware:key/list/(pair/(phrase/<id>/<params>,HMAC-SHA-1,<wrapped key>))
+type KeySafe struct {
+	Pairs []KeySafePair
+}
+
+// KeySafePair is a wrapped key along with how to unwrap it.
+type KeySafePair struct {
+	Locker KeyLocker
+	// Algorithm used to authenticate the wrapped key, e.g. HMAC-SHA-1.
+	MAC        string
+	WrappedKey []byte
+}
+
+// KeyLocker describes the key wrapping a KeySafePair.
+type KeyLocker struct {
+	// phrase for passphrase protected VMs, fqid for keys managed by a
+	// key management server.
+	Type string
+	// Unescaped path segments following the type.
+	Fields []string
+}
+
+// ID returns the identifier of a phrase locker.
+func (l KeyLocker) ID() string {
+	if len(l.Fields) == 0 {
+		return ""
+	}
+	return l.Fields[0]
+}
+
+// Params returns the key derivation parameters of a phrase locker, such
+// as pass2key, cipher, rounds and salt.
+func (l KeyLocker) Params() map[string]string {
+	params := make(map[string]string)
+	if l.Type != "phrase" || len(l.Fields) < 2 {
+		return params
+	}
+
+	for _, p := range strings.Split(l.Fields[1], ":") {
+		if i := strings.Index(p, "="); i >= 0 {
+			params[p[:i]] = p[i+1:]
+		}
+	}
+	return params
+}
+
+// KeyServerID returns the key management server of an fqid locker.
+func (l KeyLocker) KeyServerID() string {
+	if l.Type != "fqid" || len(l.Fields) < 2 {
+		return ""
+	}
+	return l.Fields[len(l.Fields)-2]
+}
+
+// KeyID returns the key identifier of an fqid locker.
+func (l KeyLocker) KeyID() string {
+	if l.Type != "fqid" || len(l.Fields) == 0 {
+		return ""
+	}
+	return l.Fields[len(l.Fields)-1]
+}
+
+const keySafePrefix = "vmware:key/list/"
+
+// ParseKeySafe parses the value of encryption.keySafe.
+func ParseKeySafe(s string) (*KeySafe, error) {
+	if !strings.HasPrefix(s, keySafePrefix) {
+		return nil, fmt.Errorf("Invalid key safe, expected %s prefix", keySafePrefix)
+	}
+
+	list, err := unwrapParens(strings.TrimPrefix(s, keySafePrefix))
+	if err != nil {
+		return nil, err
+	}
+
+	ks := new(KeySafe)
+	for _, item := range splitTopLevel(list) {
+		if !strings.HasPrefix(item, "pair/") {
+			return nil, fmt.Errorf("Invalid key safe entry: %s", item)
+		}
+
+		inner, err := unwrapParens(strings.TrimPrefix(item, "pair/"))
+		if err != nil {
+			return nil, err
+		}
+
+		parts := splitTopLevel(inner)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("Invalid key safe pair, expected locker, MAC and key: %s", inner)
+		}
+
+		segments := strings.Split(parts[0], "/")
+		locker := KeyLocker{Type: segments[0]}
+		for _, segment := range segments[1:] {
+			field, err := keySafeUnescape(segment)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid key safe locker: %v", err)
+			}
+			locker.Fields = append(locker.Fields, field)
+		}
+
+		mac, err := keySafeUnescape(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid key safe MAC: %v", err)
+		}
+
+		wrapped, err := keySafeUnescape(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid key safe wrapped key: %v", err)
+		}
+		key, err := base64.StdEncoding.DecodeString(wrapped)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid key safe wrapped key: %v", err)
+		}
+
+		ks.Pairs = append(ks.Pairs, KeySafePair{Locker: locker, MAC: mac, WrappedKey: key})
+	}
+	return ks, nil
+}
+
+// String returns the key safe in the format used by encryption.keySafe.
+func (ks *KeySafe) String() string {
+	pairs := make([]string, len(ks.Pairs))
+	for i, p := range ks.Pairs {
+		locker := []string{p.Locker.Type}
+		for _, f := range p.Locker.Fields {
+			locker = append(locker, keySafeEscape(f))
+		}
+		pairs[i] = fmt.Sprintf("pair/(%s,%s,%s)",
+			strings.Join(locker, "/"),
+			keySafeEscape(p.MAC),
+			keySafeEscape(base64.StdEncoding.EncodeToString(p.WrappedKey)))
+	}
+	return keySafePrefix + "(" + strings.Join(pairs, ",") + ")"
+}
+
+// VMware escapes every character but letters and digits as %xx.
+func keySafeEscape(s string) string {
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02x", c)
+	}
+	return b.String()
+}
+
+func keySafeUnescape(s string) (string, error) {
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			return "", fmt.Errorf("Invalid escape sequence: %s", s[i:])
+		}
+		b.WriteByte(unhex(s[i+1])<<4 | unhex(s[i+2]))
+		i += 2
+	}
+	return b.String(), nil
+}
+
+func unwrapParens(s string) (string, error) {
+	if !strings.HasPrefix(s, "(") || !strings.HasSuffix(s, ")") {
+		return "", fmt.Errorf("Invalid key safe, expected parentheses: %s", s)
+	}
+	return s[1 : len(s)-1], nil
+}
+
+// Splits s on commas that are not enclosed in parentheses.
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if start < len(s) {
+		parts = append(parts, s[start:])
+	}
+	return parts
+}
+
+// UnwrapKey returns the key of a passphrase protected VM. The wrapping
+// key is derived from passphrase with PBKDF2-HMAC-SHA-1, as described by
+// the parameters of the locker.
+func (p KeySafePair) UnwrapKey(passphrase string) ([]byte, error) {
+	if p.Locker.Type != "phrase" {
+		return nil, fmt.Errorf("Unsupported key locker: %s", p.Locker.Type)
+	}
+
+	params := p.Locker.Params()
+	if params["pass2key"] != "PBKDF2-HMAC-SHA-1" || params["cipher"] != "AES-256" {
+		return nil, fmt.Errorf("Unsupported key derivation: %s, %s", params["pass2key"], params["cipher"])
+	}
+
+	rounds, err := strconv.Atoi(params["rounds"])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid key derivation rounds: %v", err)
+	}
+	salt, err := base64.StdEncoding.DecodeString(params["salt"])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid key derivation salt: %v", err)
+	}
+
+	wrappingKey := pbkdf2(sha1.New, []byte(passphrase), salt, rounds, 32)
+	plain, err := decryptBlob(wrappingKey, p.WrappedKey)
+	if err != nil {
+		return nil, errors.New("Unable to unwrap key, wrong passphrase?")
+	}
+
+	// The unwrapped data looks like type=key:cipher=AES-256:key=<base64>
+	for _, field := range strings.Split(string(plain), ":") {
+		if strings.HasPrefix(field, "key=") {
+			value, err := keySafeUnescape(strings.TrimPrefix(field, "key="))
+			if err != nil {
+				return nil, err
+			}
+			return base64.StdEncoding.DecodeString(value)
+		}
+	}
+	return nil, errors.New("Unwrapped data does not contain a key")
+}
+
+// DecryptData decrypts the value of encryption.data with the unwrapped
+// key of the VM, returning the VMX text of the configuration.
+//
+// Decryption is best-effort: the layout of the data was worked out from
+// encrypted VMs, but how VMware derives the key of its trailing HMAC is
+// not known, so the HMAC is not verified. A wrong key is only detected
+// by the padding, which random data passes about 1 time in 256, so
+// callers must check that the result is a valid VMX file, as Decode does.
+func DecryptData(key []byte, data string) ([]byte, error) {
+	blob, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid encryption data: %v", err)
+	}
+	return decryptBlob(key, blob)
+}
+
+// Encrypted blobs are laid out as a random IV, the AES-256-CBC ciphertext
+// of the PKCS#7 padded data and a trailing HMAC-SHA-1, which is skipped.
+// See DecryptData.
+func decryptBlob(key, blob []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(blob) < aes.BlockSize+sha1.Size || (len(blob)-aes.BlockSize-sha1.Size)%aes.BlockSize != 0 {
+		return nil, errors.New("Invalid encrypted data length")
+	}
+
+	iv := blob[:aes.BlockSize]
+	ciphertext := blob[aes.BlockSize : len(blob)-sha1.Size]
+	plain := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, ciphertext)
+
+	if len(plain) == 0 {
+		return plain, nil
+	}
+	pad := int(plain[len(plain)-1])
+	if pad == 0 || pad > aes.BlockSize || pad > len(plain) {
+		return nil, errors.New("Invalid padding, wrong key?")
+	}
+	for _, b := range plain[len(plain)-pad:] {
+		if int(b) != pad {
+			return nil, errors.New("Invalid padding, wrong key?")
+		}
+	}
+	return plain[:len(plain)-pad], nil
+}
+
+// PBKDF2 as defined in RFC 2898.
+func pbkdf2(h func() hash.Hash, password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(h, password)
+	size := prf.Size()
+	blocks := (keyLen + size - 1) / size
+
+	var key []byte
+	for i := 1; i <= blocks; i++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write([]byte{byte(i >> 24), byte(i >> 16), byte(i >> 8), byte(i)})
+		u := prf.Sum(nil)
+		t := append([]byte{}, u...)
+		for n := 1; n < iterations; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
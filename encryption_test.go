@@ -0,0 +1,140 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"testing"
+)
+
+var testEncryptionKey = bytes.Repeat([]byte{0x42}, 32)
+
+func TestParseKeySafe(t *testing.T) {
+	s := "vmware:key/list/(pair/(phrase/kw0LCsTEIfg%3d/pass2key%3dPBKDF2%2dHMAC%2dSHA%2d1%3acipher%3dAES%2d256%3arounds%3d10000%3asalt%3dAKoY2vfOvKmJ6D6RHi5RqQ%3d%3d,HMAC%2dSHA%2d1,AAECAw%3d%3d)," +
+		"pair/(fqid/%3cVMWARE%2dNULL%3e/kms01/8d7f%2d11e9,HMAC%2dSHA%2d256,BAUG))"
+
+	ks, err := ParseKeySafe(s)
+	ok(t, err)
+	equals(t, 2, len(ks.Pairs))
+
+	phrase := ks.Pairs[0]
+	equals(t, "phrase", phrase.Locker.Type)
+	equals(t, "kw0LCsTEIfg=", phrase.Locker.ID())
+	equals(t, "HMAC-SHA-1", phrase.MAC)
+	equals(t, []byte{0, 1, 2, 3}, phrase.WrappedKey)
+	params := phrase.Locker.Params()
+	equals(t, "PBKDF2-HMAC-SHA-1", params["pass2key"])
+	equals(t, "10000", params["rounds"])
+	equals(t, "AKoY2vfOvKmJ6D6RHi5RqQ==", params["salt"])
+
+	fqid := ks.Pairs[1]
+	equals(t, "kms01", fqid.Locker.KeyServerID())
+	equals(t, "8d7f-11e9", fqid.Locker.KeyID())
+	equals(t, "HMAC-SHA-256", fqid.MAC)
+
+	equals(t, s, ks.String())
+
+	_, err = ParseKeySafe("vmware:key/list/(pair/(phrase/id,HMAC%2dSHA%2d1))")
+	assert(t, err != nil, "expected error for a pair without wrapped key")
+}
+
+func TestPBKDF2(t *testing.T) {
+	// RFC 6070 test vector.
+	key := pbkdf2(sha1.New, []byte("password"), []byte("salt"), 2, 20)
+	equals(t, "ea6c014dc72d6f8ccd1ed92ace1d41f0d8de8957", hex.EncodeToString(key))
+}
+
+func TestUnwrapKey(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	wrappingKey := pbkdf2(sha1.New, []byte("s3cret"), salt, 100, 32)
+	wrapped, err := testEncryptBlob(wrappingKey, []byte("type=key:cipher=AES-256:key="+base64.StdEncoding.EncodeToString(testEncryptionKey)))
+	ok(t, err)
+
+	pair := KeySafePair{
+		Locker: KeyLocker{
+			Type:   "phrase",
+			Fields: []string{"id", "pass2key=PBKDF2-HMAC-SHA-1:cipher=AES-256:rounds=100:salt=" + base64.StdEncoding.EncodeToString(salt)},
+		},
+		MAC:        "HMAC-SHA-1",
+		WrappedKey: wrapped,
+	}
+
+	key, err := pair.UnwrapKey("s3cret")
+	ok(t, err)
+	equals(t, testEncryptionKey, key)
+
+	_, err = pair.UnwrapKey("wrong")
+	assert(t, err != nil, "expected error for a wrong passphrase")
+}
+
+func TestDecodeEncrypted(t *testing.T) {
+	blob, err := testEncryptBlob(testEncryptionKey, []byte(`guestOS = "ubuntu-64"
+memsize = "2048"
+`))
+	ok(t, err)
+	data := []byte(`.encoding = "UTF-8"
+displayName = "vault"
+encryption.keySafe = "vmware:key/list/()"
+encryption.data = "` + base64.StdEncoding.EncodeToString(blob) + `"
+`)
+
+	// Without the key only plaintext keys are decoded.
+	outer := new(VirtualMachine)
+	err = Unmarshal(data, outer)
+	equals(t, ErrEncrypted, err)
+	equals(t, "vault", outer.DisplayName)
+	equals(t, "", outer.GuestOS)
+	assert(t, outer.Encrypted(), "VM should be reported as encrypted")
+
+	inner := new(VirtualMachine)
+	dec := NewDecoder(bytes.NewReader(data), false)
+	dec.EncryptionKey = testEncryptionKey
+	ok(t, dec.Decode(inner))
+	equals(t, "ubuntu-64", inner.GuestOS)
+	equals(t, uint(2048), inner.Memsize)
+	equals(t, "vmware:key/list/()", inner.Encryption.KeySafe)
+
+	// A wrong key is not always caught by the padding, but what it
+	// decrypts to is not a VMX file and is never merged.
+	garbage, err := testEncryptBlob(testEncryptionKey, []byte{0xde, 0xad, 0xbe, 0xef, '\n', 'x'})
+	ok(t, err)
+	wrong := NewDecoder(bytes.NewReader([]byte(`displayName = "vault"
+encryption.data = "`+base64.StdEncoding.EncodeToString(garbage)+`"
+`)), false)
+	wrong.EncryptionKey = testEncryptionKey
+	partial := new(VirtualMachine)
+	assert(t, wrong.Decode(partial) != nil, "expected error for data that is not a VMX file")
+	equals(t, "", partial.DisplayName)
+
+	// Decrypted VMs are neither written back in plaintext nor
+	// re-encrypted.
+	_, err = Marshal(inner)
+	assert(t, err != nil, "expected error encoding an encrypted VM")
+}
+
+// Encrypts plaintext the way decryptBlob expects it. The trailing HMAC
+// is zeroed as it is not verified.
+func testEncryptBlob(key, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	pad := aes.BlockSize - len(plaintext)%aes.BlockSize
+	padded := append(append([]byte{}, plaintext...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+
+	blob := make([]byte, aes.BlockSize+len(padded)+sha1.Size)
+	if _, err := io.ReadFull(rand.Reader, blob[:aes.BlockSize]); err != nil {
+		return nil, err
+	}
+	cipher.NewCBCEncrypter(block, blob[:aes.BlockSize]).CryptBlocks(blob[aes.BlockSize:aes.BlockSize+len(padded)], padded)
+	return blob, nil
+}
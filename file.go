@@ -0,0 +1,263 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrModified is returned by WriteFile when the file changed on disk
+// since its snapshot was taken.
+var ErrModified = errors.New("file was modified since it was read")
+
+// FileSnapshot identifies the contents of a file at the time it was read.
+type FileSnapshot struct {
+	ModTime time.Time
+	Size    int64
+	SHA256  [sha256.Size]byte
+}
+
+// Reports whether the file described by s is unchanged since other was
+// taken. time.Time values must not be compared with ==, as their location
+// and monotonic clock reading would be compared too.
+func (s *FileSnapshot) matches(other *FileSnapshot) bool {
+	return s.ModTime.Equal(other.ModTime) && s.Size == other.Size && s.SHA256 == other.SHA256
+}
+
+func newSnapshot(info os.FileInfo, data []byte) *FileSnapshot {
+	return &FileSnapshot{
+		ModTime: info.ModTime(),
+		Size:    info.Size(),
+		SHA256:  sha256.Sum256(data),
+	}
+}
+
+// ReadFile reads the VMX file at path into v, which can be a *Document or
+// any value accepted by Unmarshal. The returned snapshot can be passed to
+// WriteFile to detect concurrent modifications.
+func ReadFile(path string, v interface{}) (*FileSnapshot, error) {
+	data, info, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if doc, ok := v.(*Document); ok {
+		parsed, err := ParseDocument(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		*doc = *parsed
+	} else if err := Unmarshal(data, v); err != nil {
+		return nil, err
+	}
+	return newSnapshot(info, data), nil
+}
+
+func readFile(path string) ([]byte, os.FileInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, info, nil
+}
+
+// WriteOptions customizes WriteFile.
+type WriteOptions struct {
+	// Number of backups to keep. The previous contents go to path.bak, the
+	// one before to path.bak.1 and so on. Zero keeps no backups.
+	Backups int
+	// If set, WriteFile fails with ErrModified when the file no longer
+	// matches the snapshot.
+	Snapshot *FileSnapshot
+	// Lock held by the caller, see AcquireLock. WriteFile fails with a
+	// *LockedError if the file is locked by anyone else.
+	Lock *Lock
+	// Write the file even if it is locked.
+	IgnoreLocks bool
+	// Permissions of the file when it does not exist yet. Existing files
+	// keep their permissions and ownership. Defaults to 0644.
+	Perm os.FileMode
+}
+
+// WriteFile writes v, a *Document or any value accepted by Marshal, to
+// path without ever leaving a partially written file behind: data is
+// written and synced to a temporary file in the same directory, which is
+// then renamed over path. Locked files are not written, see WriteOptions.
+func WriteFile(path string, v interface{}, opts *WriteOptions) error {
+	if opts == nil {
+		opts = new(WriteOptions)
+	}
+
+	var data []byte
+	if doc, ok := v.(*Document); ok {
+		data = doc.Bytes()
+	} else {
+		var err error
+		if data, err = Marshal(v); err != nil {
+			return err
+		}
+	}
+
+	perm := opts.Perm
+	if perm == 0 {
+		perm = 0644
+	}
+
+	if !opts.IgnoreLocks {
+		if err := checkWriteLock(path, opts.Lock); err != nil {
+			return err
+		}
+	}
+
+	old, info, err := readFile(path)
+	switch {
+	case os.IsNotExist(err):
+		if opts.Snapshot != nil {
+			return ErrModified
+		}
+	case err != nil:
+		return err
+	default:
+		perm = info.Mode().Perm()
+		if opts.Snapshot != nil && !opts.Snapshot.matches(newSnapshot(info, old)) {
+			return ErrModified
+		}
+		if opts.Backups > 0 {
+			if err := backupFile(path, old, perm, info, opts.Backups); err != nil {
+				return err
+			}
+		}
+	}
+
+	return writeAtomic(path, data, perm, info)
+}
+
+// Writes data to a temporary file in the directory of path, which is then
+// renamed over path. If info is not nil, the file gets its ownership.
+func writeAtomic(path string, data []byte, perm os.FileMode, info os.FileInfo) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	// Removing the file fails once it has been renamed, which is fine.
+	defer os.Remove(tmp.Name())
+
+	if err := writeTemp(tmp, data, perm, info); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// UpdateFile reads the VMX-like file at path into v, a pointer to a
+// struct, calls update to change it and writes back the keys of the
+// fields that changed, leaving every other line of the file as it was.
+// See Document.Update. Files that do not exist are created.
+func UpdateFile(path string, v interface{}, update func() error, opts *WriteOptions) error {
+	doc := new(Document)
+	snapshot, err := ReadFile(path, doc)
+	if os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	if err := doc.Decode(v); err != nil {
+		return err
+	}
+	if err := update(); err != nil {
+		return err
+	}
+	if err := doc.Update(v); err != nil {
+		return err
+	}
+
+	o := WriteOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Snapshot == nil {
+		o.Snapshot = snapshot
+	}
+	return WriteFile(path, doc, &o)
+}
+
+// Fails if path is locked by anyone but l.
+func checkWriteLock(path string, l *Lock) error {
+	var locks []LockInfo
+	var err error
+	if l != nil {
+		locks, err = l.others()
+	} else {
+		locks, err = CheckLock(path)
+	}
+
+	if err != nil {
+		return err
+	}
+	if len(locks) > 0 {
+		return &LockedError{Path: path, Locks: locks}
+	}
+	return nil
+}
+
+func writeTemp(f *os.File, data []byte, perm os.FileMode, info os.FileInfo) error {
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		return err
+	}
+	if info != nil {
+		if err := chown(f, info); err != nil {
+			return err
+		}
+	}
+	return f.Sync()
+}
+
+// Rotates the backups of path and saves data as the most recent one.
+func backupFile(path string, data []byte, perm os.FileMode, info os.FileInfo, backups int) error {
+	name := func(i int) string {
+		if i == 0 {
+			return path + ".bak"
+		}
+		return fmt.Sprintf("%s.bak.%d", path, i)
+	}
+
+	for i := backups - 1; i > 0; i-- {
+		err := os.Rename(name(i-1), name(i))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return writeAtomic(name(0), data, perm, info)
+}
@@ -0,0 +1,66 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govmx")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "core01.vmx")
+	ok(t, ioutil.WriteFile(path, []byte("displayName = \"core01\"\n"), 0600))
+
+	doc := new(Document)
+	snapshot, err := ReadFile(path, doc)
+	ok(t, err)
+	doc.Set("memsize", "1024")
+
+	ok(t, WriteFile(path, doc, &WriteOptions{Snapshot: snapshot, Backups: 2}))
+
+	data, err := ioutil.ReadFile(path)
+	ok(t, err)
+	equals(t, "displayName = \"core01\"\nmemsize = \"1024\"\n", string(data))
+
+	info, err := os.Stat(path)
+	ok(t, err)
+	equals(t, os.FileMode(0600), info.Mode().Perm())
+
+	backup, err := ioutil.ReadFile(path + ".bak")
+	ok(t, err)
+	equals(t, "displayName = \"core01\"\n", string(backup))
+	info, err = os.Stat(path + ".bak")
+	ok(t, err)
+	equals(t, os.FileMode(0600), info.Mode().Perm())
+
+	// The file changed since the snapshot was taken.
+	err = WriteFile(path, doc, &WriteOptions{Snapshot: snapshot})
+	equals(t, ErrModified, err)
+
+	vm := new(VirtualMachine)
+	snapshot, err = ReadFile(path, vm)
+	ok(t, err)
+	equals(t, uint(1024), vm.Memsize)
+
+	// Snapshots taken in another location still match.
+	snapshot.ModTime = snapshot.ModTime.In(time.FixedZone("CET", 3600))
+	vm.Memsize = 2048
+	ok(t, WriteFile(path, vm, &WriteOptions{Snapshot: snapshot, Backups: 2}))
+
+	backup, err = ioutil.ReadFile(path + ".bak.1")
+	ok(t, err)
+	equals(t, "displayName = \"core01\"\n", string(backup))
+
+	// No temporary files are left behind.
+	files, err := ioutil.ReadDir(dir)
+	ok(t, err)
+	equals(t, 3, len(files))
+}
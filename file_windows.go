@@ -0,0 +1,20 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build windows
+// +build windows
+
+package vmx
+
+import "os"
+
+// Ownership is inherited from the directory on Windows.
+func chown(f *os.File, info os.FileInfo) error {
+	return nil
+}
+
+// Directories cannot be synced on Windows.
+func syncDir(dir string) error {
+	return nil
+}
@@ -0,0 +1,331 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// Keys written at the top of the file, in this order, as VMware does.
+var headerKeys = []string{
+	".encoding",
+	"config.version",
+	"virtualHW.version",
+}
+
+// Canonical casing of well known keys, as written by VMware products.
+var canonicalKeys = makeCanonicalKeys(
+	".encoding",
+	"annotation",
+	"bios.bootOrder",
+	"bios.hddOrder",
+	"checkpoint.vmState",
+	"cleanShutdown",
+	"config.version",
+	"cpuid.coresPerSocket",
+	"displayName",
+	"ehci.pciSlotNumber",
+	"ehci.present",
+	"extendedConfigFile",
+	"guestOS",
+	"gui.exitAtPowerOff",
+	"gui.exitOnCLIHLT",
+	"gui.fullScreenAtPowerOn",
+	"gui.powerOnAtStartup",
+	"gui.viewModeAtPowerOn",
+	"hgfs.linkRootShare",
+	"hgfs.mapRootShare",
+	"isolation.tools.copy.disable",
+	"isolation.tools.dnd.disable",
+	"isolation.tools.hgfs.disable",
+	"isolation.tools.paste.disable",
+	"mem.hotadd",
+	"memsize",
+	"monitor.phys_bits_used",
+	"msg.autoAnswer",
+	"numvcpus",
+	"nvram",
+	"powerType.powerOff",
+	"powerType.powerOn",
+	"powerType.reset",
+	"powerType.suspend",
+	"proxyApps.publishToHost",
+	"RemoteDisplay.depth",
+	"RemoteDisplay.maxConnections",
+	"RemoteDisplay.maxHeight",
+	"RemoteDisplay.maxWidth",
+	"RemoteDisplay.vnc.enabled",
+	"RemoteDisplay.vnc.ip",
+	"RemoteDisplay.vnc.key",
+	"RemoteDisplay.vnc.keyMap",
+	"RemoteDisplay.vnc.keyMapFile",
+	"RemoteDisplay.vnc.password",
+	"RemoteDisplay.vnc.port",
+	"RemoteDisplay.vnc.zlibLevel",
+	"replay.filename",
+	"replay.supported",
+	"rtc.diffFromUTC",
+	"softPowerOff",
+	"sound.autodetect",
+	"sound.fileName",
+	"sound.present",
+	"sound.startConnected",
+	"tools.remindInstall",
+	"tools.syncTime",
+	"tools.upgrade.policy",
+	"usb.generic.autoconnect",
+	"usb.present",
+	"uuid.action",
+	"uuid.bios",
+	"uuid.location",
+	"vc.uuid",
+	"vcpu.hotadd",
+	"vhv.enable",
+	"virtualHW.productCompatibility",
+	"virtualHW.version",
+	"vmotion.checkpointFBSize",
+)
+
+// Canonical casing of well known device attributes, the part of the key
+// following the device, as in ethernet0.virtualDev.
+var canonicalDeviceKeys = makeCanonicalKeys(
+	"address",
+	"addressType",
+	"allowGuestConnectionControl",
+	"autodetect",
+	"connectionType",
+	"deviceType",
+	"enabled",
+	"expiration",
+	"fileName",
+	"fileType",
+	"functions",
+	"generatedAddress",
+	"generatedAddressOffset",
+	"guestName",
+	"hardwareFlowControl",
+	"hostPath",
+	"id",
+	"linkStatePropagation.enable",
+	"mode",
+	"parent",
+	"pciSlotNumber",
+	"pipe.endpoint",
+	"port",
+	"present",
+	"readAccess",
+	"redo",
+	"speed",
+	"startConnected",
+	"tryNoRxLoss",
+	"virtualDev",
+	"vnet",
+	"wakeOnPcktRcv",
+	"writeAccess",
+)
+
+// Canonical casing of device names, without their index.
+var canonicalDevices = makeCanonicalKeys(
+	"ethernet",
+	"floppy",
+	"ide",
+	"nvme",
+	"pciBridge",
+	"sata",
+	"scsi",
+	"serial",
+	"sharedFolder",
+	"usb",
+	"vmci",
+)
+
+func makeCanonicalKeys(keys ...string) map[string]string {
+	m := make(map[string]string, len(keys))
+	for _, k := range keys {
+		m[strings.ToLower(k)] = k
+	}
+	return m
+}
+
+// CanonicalKey returns key with the casing VMware uses for it. Unknown
+// keys are returned as they are.
+func CanonicalKey(key string) string {
+	lower := strings.ToLower(key)
+	if k, found := canonicalKeys[lower]; found {
+		return k
+	}
+
+	device := DeviceOf(key)
+	if device == "" {
+		return key
+	}
+
+	name := strings.TrimRight(device, "0123456789:")
+	if n, found := canonicalDevices[name]; found {
+		device = n + device[len(name):]
+	} else {
+		device = key[:len(device)]
+	}
+
+	attr := key[len(device)+1:]
+	if a, found := canonicalDeviceKeys[strings.ToLower(attr)]; found {
+		attr = a
+	}
+	return device + "." + attr
+}
+
+// Format returns the canonical form of the VMX file in src:
+//   - Every entry written as key = "value", with the casing VMware uses
+//     for well known keys.
+//   - .encoding, config.version and virtualHW.version first, then the
+//     rest of standalone keys, then devices, each sorted by name.
+//   - Booleans written as "TRUE" or "FALSE".
+//   - Duplicated keys removed, keeping the last value as VMware does.
+//
+// Comments are kept above the entry they precede. Blank lines are removed.
+func Format(src []byte) ([]byte, error) {
+	doc, err := ParseDocument(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	return FormatDocument(doc).Bytes(), nil
+}
+
+// FormatDocument returns a new document with the canonical form of doc.
+// See Format.
+func FormatDocument(doc *Document) *Document {
+	type entry struct {
+		docLine
+		comments []docLine
+	}
+
+	var header, trailer []docLine
+	var comments []docLine
+	entries := make(map[string]*entry)
+	for i, l := range doc.lines {
+		if !l.isEntry {
+			// Keeps the interpreter line, #!/usr/bin/vmware, at the top.
+			if i == 0 && strings.HasPrefix(l.raw, "#!") {
+				header = append(header, l)
+			} else if strings.TrimSpace(l.raw) != "" {
+				comments = append(comments, l)
+			}
+			continue
+		}
+
+		key := strings.ToLower(l.Key)
+		e := entries[key]
+		if e == nil {
+			e = new(entry)
+			entries[key] = e
+		}
+		e.docLine = docLine{
+			Entry:   Entry{Key: CanonicalKey(l.Key), Value: formatValue(l.Value)},
+			isEntry: true,
+		}
+		e.comments = append(e.comments, comments...)
+		comments = nil
+	}
+	trailer = comments
+
+	keys := make([]string, 0, len(entries))
+	for k := range entries {
+		keys = append(keys, k)
+	}
+	sort.Sort(byKey(keys))
+
+	formatted := &Document{newline: doc.newline}
+	formatted.lines = append(formatted.lines, header...)
+	for _, k := range keys {
+		e := entries[k]
+		formatted.lines = append(formatted.lines, e.comments...)
+		formatted.lines = append(formatted.lines, e.docLine)
+	}
+	formatted.lines = append(formatted.lines, trailer...)
+	return formatted
+}
+
+func formatValue(value string) string {
+	if isBoolValue(value) {
+		return strings.ToUpper(value)
+	}
+	return value
+}
+
+// Sorts keys in canonical order.
+type byKey []string
+
+func (k byKey) Len() int           { return len(k) }
+func (k byKey) Swap(i, j int)      { k[i], k[j] = k[j], k[i] }
+func (k byKey) Less(i, j int) bool { return lessKey(k[i], k[j]) }
+
+// Orders lowercased keys: header keys first, then standalone keys, then
+// devices. Devices are compared so that ethernet2 comes before ethernet10.
+func lessKey(a, b string) bool {
+	ha, hb := headerIndex(a), headerIndex(b)
+	if ha != hb {
+		return ha < hb
+	}
+
+	da, db := DeviceOf(a), DeviceOf(b)
+	if (da == "") != (db == "") {
+		return da == ""
+	}
+	if da != db {
+		return lessNatural(da, db)
+	}
+	return a < b
+}
+
+// Returns the position of key among the header keys, or their count if
+// key is not one of them.
+func headerIndex(key string) int {
+	for i, k := range headerKeys {
+		if strings.EqualFold(k, key) {
+			return i
+		}
+	}
+	return len(headerKeys)
+}
+
+// Compares strings treating runs of digits as numbers.
+func lessNatural(a, b string) bool {
+	for a != "" && b != "" {
+		na, ra := leadingNumber(a)
+		nb, rb := leadingNumber(b)
+		if ra != "" && rb != "" {
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			a, b = a[len(ra):], b[len(rb):]
+			continue
+		}
+
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+// Returns the leading run of digits of s, without leading zeros, along
+// with the run as it appears in s.
+func leadingNumber(s string) (string, string) {
+	i := 0
+	for i < len(s) && '0' <= s[i] && s[i] <= '9' {
+		i++
+	}
+	run := s[:i]
+	n := strings.TrimLeft(run, "0")
+	if n == "" && run != "" {
+		n = "0"
+	}
+	return n, run
+}
@@ -0,0 +1,87 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestCanonicalKey(t *testing.T) {
+	tests := []struct {
+		key       string
+		canonical string
+	}{
+		{"displayname", "displayName"},
+		{"VIRTUALHW.VERSION", "virtualHW.version"},
+		{"remotedisplay.vnc.enabled", "RemoteDisplay.vnc.enabled"},
+		{"ethernet10.virtualdev", "ethernet10.virtualDev"},
+		{"scsi0:1.FILENAME", "scsi0:1.fileName"},
+		{"sharedfolder0.hostpath", "sharedFolder0.hostPath"},
+		{"usb:0.devicetype", "usb:0.deviceType"},
+		{"ethernet0.someNewSetting", "ethernet0.someNewSetting"},
+		{"foo.Bar", "foo.Bar"},
+	}
+
+	for _, tt := range tests {
+		equals(t, tt.canonical, CanonicalKey(tt.key))
+	}
+}
+
+func TestFormat(t *testing.T) {
+	src := []byte(`#!/usr/bin/vmware
+memsize = 512
+ethernet10.present = "true"
+# Bridged to the office network
+ethernet2.connectiontype = "bridged"
+ethernet2.present="TRUE"
+scsi0:0.fileName = "disk.vmdk"
+DisplayName = "core01"
+
+virtualhw.version = "9"
+memsize = "1024"
+config.version = "8"
+.encoding = "UTF-8"
+# trailing comment
+`)
+
+	formatted, err := Format(src)
+	ok(t, err)
+	equals(t, `#!/usr/bin/vmware
+.encoding = "UTF-8"
+config.version = "8"
+virtualHW.version = "9"
+displayName = "core01"
+memsize = "1024"
+# Bridged to the office network
+ethernet2.connectionType = "bridged"
+ethernet2.present = "TRUE"
+ethernet10.present = "TRUE"
+scsi0:0.fileName = "disk.vmdk"
+# trailing comment
+`, string(formatted))
+
+	again, err := Format(formatted)
+	ok(t, err)
+	equals(t, string(formatted), string(again))
+}
+
+func TestFormatFixtures(t *testing.T) {
+	for _, name := range []string{"a.vmx", "b.vmx"} {
+		data, err := ioutil.ReadFile(filepath.Join(".", "fixtures", name))
+		ok(t, err)
+
+		formatted, err := Format(data)
+		ok(t, err)
+
+		before := new(VirtualMachine)
+		ok(t, Unmarshal(data, before))
+		after := new(VirtualMachine)
+		ok(t, Unmarshal(formatted, after))
+		equals(t, len(before.Ethernet), len(after.Ethernet))
+		equals(t, before.DisplayName, after.DisplayName)
+		equals(t, before.Memsize, after.Memsize)
+	}
+}
@@ -0,0 +1,145 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Encodings of guestinfo payloads, as understood by cloud-init and
+// VMware Tools.
+const (
+	GuestInfoEncodingBase64     = "base64"
+	GuestInfoEncodingGzipBase64 = "gzip+base64"
+)
+
+// Conventional guestinfo variables read by cloud-init.
+const (
+	GuestInfoMetadata   = "metadata"
+	GuestInfoUserdata   = "userdata"
+	GuestInfoVendordata = "vendordata"
+)
+
+// GuestInfo holds the guestinfo.* variables of a VM, which guests can read
+// with VMware Tools, by name without the guestinfo prefix. Names are case
+// insensitive, they are lowercased when decoded.
+type GuestInfo map[string]string
+
+// Get returns the value of the variable name.
+func (g GuestInfo) Get(name string) (string, bool) {
+	value, found := g[strings.ToLower(name)]
+	return value, found
+}
+
+// Set sets the variable name.
+func (g *GuestInfo) Set(name, value string) {
+	if *g == nil {
+		*g = make(GuestInfo)
+	}
+	(*g)[strings.ToLower(name)] = value
+}
+
+// Delete removes the variable name along with its encoding, if any.
+func (g GuestInfo) Delete(name string) {
+	name = strings.ToLower(name)
+	delete(g, name)
+	delete(g, name+".encoding")
+}
+
+// Payload returns the decoded value of the variable name, following the
+// encoding given by the variable name.encoding: base64, gzip+base64 or
+// none.
+func (g GuestInfo) Payload(name string) ([]byte, bool, error) {
+	value, found := g.Get(name)
+	if !found {
+		return nil, false, nil
+	}
+	encoding, _ := g.Get(name + ".encoding")
+	data, err := decodePayload(value, encoding)
+	return data, true, err
+}
+
+// SetPayload sets the variable name to data encoded with encoding, which
+// is recorded in the variable name.encoding. Data is set as it is when
+// encoding is empty.
+func (g *GuestInfo) SetPayload(name string, data []byte, encoding string) error {
+	value, err := encodePayload(data, encoding)
+	if err != nil {
+		return err
+	}
+
+	g.Set(name, value)
+	if encoding == "" {
+		delete(*g, strings.ToLower(name)+".encoding")
+	} else {
+		g.Set(name+".encoding", encoding)
+	}
+	return nil
+}
+
+// Metadata returns the decoded guestinfo.metadata payload.
+func (g GuestInfo) Metadata() ([]byte, bool, error) {
+	return g.Payload(GuestInfoMetadata)
+}
+
+// SetMetadata sets the guestinfo.metadata payload. See SetPayload.
+func (g *GuestInfo) SetMetadata(data []byte, encoding string) error {
+	return g.SetPayload(GuestInfoMetadata, data, encoding)
+}
+
+// Userdata returns the decoded guestinfo.userdata payload.
+func (g GuestInfo) Userdata() ([]byte, bool, error) {
+	return g.Payload(GuestInfoUserdata)
+}
+
+// SetUserdata sets the guestinfo.userdata payload. See SetPayload.
+func (g *GuestInfo) SetUserdata(data []byte, encoding string) error {
+	return g.SetPayload(GuestInfoUserdata, data, encoding)
+}
+
+func encodePayload(data []byte, encoding string) (string, error) {
+	switch strings.ToLower(encoding) {
+	case "":
+		return string(data), nil
+	case GuestInfoEncodingBase64, "b64":
+		return base64.StdEncoding.EncodeToString(data), nil
+	case GuestInfoEncodingGzipBase64, "gz+b64":
+		var b bytes.Buffer
+		w := gzip.NewWriter(&b)
+		if _, err := w.Write(data); err != nil {
+			return "", err
+		}
+		if err := w.Close(); err != nil {
+			return "", err
+		}
+		return base64.StdEncoding.EncodeToString(b.Bytes()), nil
+	}
+	return "", fmt.Errorf("Unsupported guestinfo encoding: %s", encoding)
+}
+
+func decodePayload(value, encoding string) ([]byte, error) {
+	switch strings.ToLower(encoding) {
+	case "":
+		return []byte(value), nil
+	case GuestInfoEncodingBase64, "b64":
+		return base64.StdEncoding.DecodeString(value)
+	case GuestInfoEncodingGzipBase64, "gz+b64":
+		compressed, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, err
+		}
+		r, err := gzip.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	}
+	return nil, fmt.Errorf("Unsupported guestinfo encoding: %s", encoding)
+}
@@ -0,0 +1,60 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGuestInfo(t *testing.T) {
+	vm := new(VirtualMachine)
+	err := Unmarshal([]byte(`displayName = "core01"
+guestinfo.hostname = "core01"
+guestinfo.metadata = "aW5zdGFuY2UtaWQ6IGNvcmUwMQo="
+guestinfo.metadata.encoding = "base64"
+`), vm)
+	ok(t, err)
+
+	hostname, found := vm.GuestInfo.Get("HostName")
+	assert(t, found, "expected guestinfo.hostname")
+	equals(t, "core01", hostname)
+
+	metadata, found, err := vm.GuestInfo.Metadata()
+	ok(t, err)
+	assert(t, found, "expected guestinfo.metadata")
+	equals(t, "instance-id: core01\n", string(metadata))
+
+	_, found, err = vm.GuestInfo.Userdata()
+	ok(t, err)
+	assert(t, !found, "expected no guestinfo.userdata")
+
+	userdata := []byte("#cloud-config\nhostname: core01\n")
+	ok(t, vm.GuestInfo.SetUserdata(userdata, GuestInfoEncodingGzipBase64))
+	decoded, _, err := vm.GuestInfo.Userdata()
+	ok(t, err)
+	equals(t, userdata, decoded)
+
+	ok(t, vm.GuestInfo.SetMetadata([]byte("instance-id: web01\n"), ""))
+	_, found = vm.GuestInfo.Get("metadata.encoding")
+	assert(t, !found, "expected guestinfo.metadata.encoding to be removed")
+
+	vm.GuestInfo.Delete("userdata")
+	equals(t, GuestInfo{"hostname": "core01", "metadata": "instance-id: web01\n"}, vm.GuestInfo)
+
+	data, err := Marshal(vm)
+	ok(t, err)
+	assert(t, strings.Contains(string(data), "guestinfo.hostname = \"core01\"\nguestinfo.metadata = \"instance-id: web01|0A\"\n"),
+		"expected guestinfo variables in:\n%s", data)
+	assert(t, !strings.Contains(vm.String(), "core01\"\nguestinfo.metadata"), "expected guestinfo to be redacted in:\n%s", vm.String())
+
+	err = vm.GuestInfo.SetPayload("userdata", userdata, "rot13")
+	assert(t, err != nil, "expected error for an unsupported encoding")
+}
+
+func TestGuestInfoSetNil(t *testing.T) {
+	var g GuestInfo
+	g.Set("Role", "web")
+	equals(t, GuestInfo{"role": "web"}, g)
+}
@@ -0,0 +1,202 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+)
+
+// Control is a single setting required by a hardening profile.
+type Control struct {
+	Key      string
+	Expected string
+	// Value VMware assumes when Key is not present in the file.
+	Default     string
+	Description string
+}
+
+// HardeningProfile is a named set of controls, modeled after VMware's
+// security hardening guides.
+type HardeningProfile struct {
+	Name        string
+	Description string
+	Controls    []Control
+}
+
+var baselineControls = []Control{
+	{"isolation.tools.copy.disable", "TRUE", "FALSE", "Disable copying from the guest to the host clipboard"},
+	{"isolation.tools.paste.disable", "TRUE", "FALSE", "Disable pasting from the host clipboard into the guest"},
+	{"isolation.tools.dnd.disable", "TRUE", "FALSE", "Disable drag and drop between the guest and the host"},
+	{"isolation.tools.setGUIOptions.enable", "FALSE", "FALSE", "Do not let the guest change the copy and paste settings"},
+	{"isolation.tools.diskShrink.disable", "TRUE", "FALSE", "Disable virtual disk shrinking from the guest"},
+	{"isolation.tools.diskWiper.disable", "TRUE", "FALSE", "Disable virtual disk wiping from the guest"},
+	{"isolation.device.connectable.disable", "TRUE", "FALSE", "Prevent the guest from connecting and disconnecting devices"},
+	{"tools.setInfo.sizeLimit", "1048576", "", "Limit the data the guest can send to the host to 1MB"},
+	{"tools.guestlib.enableHostInfo", "FALSE", "FALSE", "Do not let the guest query host performance information"},
+	{"RemoteDisplay.maxConnections", "1", "", "Allow a single remote console connection"},
+	{"log.keepOld", "10", "6", "Keep at most 10 old log files"},
+	{"log.rotateSize", "2048000", "", "Rotate the log at 2MB"},
+}
+
+var strictControls = append(append([]Control{}, baselineControls...), []Control{
+	{"isolation.tools.hgfs.disable", "TRUE", "FALSE", "Disable shared folders"},
+	{"isolation.device.edit.disable", "TRUE", "FALSE", "Prevent the guest from modifying devices"},
+	{"isolation.tools.autoInstall.disable", "TRUE", "FALSE", "Disable VMware Tools automatic upgrades from the guest"},
+	{"isolation.tools.vixMessage.disable", "TRUE", "FALSE", "Disable VIX messages from the guest"},
+	{"isolation.tools.getCreds.disable", "TRUE", "FALSE", "Disable the guest credentials API"},
+	{"isolation.tools.unity.disable", "TRUE", "FALSE", "Disable Unity"},
+	{"isolation.tools.unityInterlockOperation.disable", "TRUE", "FALSE", "Disable Unity interlock operations"},
+	{"isolation.tools.unity.push.update.disable", "TRUE", "FALSE", "Disable Unity push updates"},
+	{"isolation.tools.unity.taskbar.disable", "TRUE", "FALSE", "Disable the Unity taskbar"},
+	{"isolation.tools.unity.windowContents.disable", "TRUE", "FALSE", "Disable Unity window contents"},
+	{"isolation.tools.unityActive.disable", "TRUE", "FALSE", "Disable active Unity"},
+	{"isolation.tools.ghi.autologon.disable", "TRUE", "FALSE", "Disable guest host integration autologon"},
+	{"isolation.tools.ghi.launchmenu.change", "TRUE", "FALSE", "Prevent the guest from changing the host launch menu"},
+	{"isolation.tools.ghi.protocolhandler.info.disable", "TRUE", "FALSE", "Disable guest protocol handler information"},
+	{"isolation.tools.ghi.trayicon.disable", "TRUE", "FALSE", "Disable the guest tray icon in the host"},
+	{"isolation.ghi.host.shellAction.disable", "TRUE", "FALSE", "Disable host shell actions from the guest"},
+	{"isolation.tools.trashFolderState.disable", "TRUE", "FALSE", "Disable trash folder state updates from the guest"},
+	{"isolation.tools.dispTopoRequest.disable", "TRUE", "FALSE", "Disable display topology requests from the guest"},
+	{"isolation.tools.memSchedFakeSampleStats.disable", "TRUE", "FALSE", "Disable fake memory scheduler statistics"},
+	{"RemoteDisplay.vnc.enabled", "FALSE", "FALSE", "Disable the VNC server"},
+}...)
+
+var hardeningProfiles = []HardeningProfile{
+	{
+		Name:        "baseline",
+		Description: "Settings every VM should have: no clipboard or disk tampering from the guest, bounded logs and guest messages",
+		Controls:    baselineControls,
+	},
+	{
+		Name:        "strict",
+		Description: "Baseline plus no shared folders, guest host integration, device editing or VNC",
+		Controls:    strictControls,
+	},
+}
+
+// HardeningProfiles returns the built-in hardening profiles.
+func HardeningProfiles() []HardeningProfile {
+	profiles := make([]HardeningProfile, len(hardeningProfiles))
+	copy(profiles, hardeningProfiles)
+	return profiles
+}
+
+// LookupHardeningProfile returns the built-in profile with the given name.
+func LookupHardeningProfile(name string) (HardeningProfile, bool) {
+	for _, p := range hardeningProfiles {
+		if strings.EqualFold(p.Name, name) {
+			return p, true
+		}
+	}
+	return HardeningProfile{}, false
+}
+
+// ControlResult is the outcome of auditing a single control.
+type ControlResult struct {
+	Control
+	// Value found in the file, or the control's default if not present.
+	Actual  string
+	Present bool
+	Pass    bool
+}
+
+// ComplianceReport lists the result of every control of a profile.
+type ComplianceReport struct {
+	Profile string
+	Results []ControlResult
+}
+
+// Passed reports whether every control passed.
+func (r ComplianceReport) Passed() bool {
+	for _, result := range r.Results {
+		if !result.Pass {
+			return false
+		}
+	}
+	return true
+}
+
+// Failed returns the results of the controls that did not pass.
+func (r ComplianceReport) Failed() []ControlResult {
+	var failed []ControlResult
+	for _, result := range r.Results {
+		if !result.Pass {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// String renders the report as a table, one control per line.
+func (r ComplianceReport) String() string {
+	var b bytes.Buffer
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "RESULT\tKEY\tEXPECTED\tACTUAL\n")
+	for _, result := range r.Results {
+		status := "PASS"
+		if !result.Pass {
+			status = "FAIL"
+		}
+		actual := result.Actual
+		if !result.Present {
+			actual = fmt.Sprintf("(unset, default %q)", result.Default)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", status, result.Key, result.Expected, actual)
+	}
+	w.Flush()
+	return b.String()
+}
+
+// Audit checks doc against every control of the profile.
+func (p HardeningProfile) Audit(doc *Document) ComplianceReport {
+	report := ComplianceReport{Profile: p.Name}
+	for _, c := range p.Controls {
+		actual, present := doc.Get(c.Key)
+		if !present {
+			actual = c.Default
+		}
+		report.Results = append(report.Results, ControlResult{
+			Control: c,
+			Actual:  actual,
+			Present: present,
+			Pass:    equalValues(actual, c.Expected),
+		})
+	}
+	return report
+}
+
+// Apply sets every control of the profile in doc.
+func (p HardeningProfile) Apply(doc *Document) {
+	for _, c := range p.Controls {
+		if value, found := doc.Get(c.Key); !found || !equalValues(value, c.Expected) {
+			doc.Set(c.Key, c.Expected)
+		}
+	}
+}
+
+// AuditVM checks vm against every control of the profile.
+func (p HardeningProfile) AuditVM(vm *VirtualMachine) (ComplianceReport, error) {
+	data, err := Marshal(vm)
+	if err != nil {
+		return ComplianceReport{}, err
+	}
+
+	doc, err := ParseDocument(bytes.NewReader(data))
+	if err != nil {
+		return ComplianceReport{}, err
+	}
+	return p.Audit(doc), nil
+}
+
+// ApplyVM sets the fields of vm mapped to the controls of the profile.
+func (p HardeningProfile) ApplyVM(vm *VirtualMachine) error {
+	values := make(map[string]string, len(p.Controls))
+	for _, c := range p.Controls {
+		values[c.Key] = c.Expected
+	}
+	return decodeValues(values, vm)
+}
@@ -0,0 +1,66 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHardeningAudit(t *testing.T) {
+	profile, found := LookupHardeningProfile("baseline")
+	assert(t, found, "baseline profile should exist")
+
+	doc, err := ParseDocument(strings.NewReader(`isolation.tools.copy.disable = "true"
+isolation.tools.paste.disable = "FALSE"
+log.keepOld = "10"
+`))
+	ok(t, err)
+
+	report := profile.Audit(doc)
+	assert(t, !report.Passed(), "report should not pass")
+	equals(t, len(profile.Controls), len(report.Results))
+
+	results := make(map[string]ControlResult)
+	for _, r := range report.Results {
+		results[r.Key] = r
+	}
+	equals(t, ControlResult{Control: profile.Controls[0], Actual: "true", Present: true, Pass: true}, results["isolation.tools.copy.disable"])
+	equals(t, false, results["isolation.tools.paste.disable"].Pass)
+	equals(t, true, results["isolation.tools.setGUIOptions.enable"].Pass)
+	equals(t, false, results["isolation.tools.setGUIOptions.enable"].Present)
+	equals(t, "", results["tools.setInfo.sizeLimit"].Actual)
+	equals(t, true, results["log.keepOld"].Pass)
+	assert(t, strings.Contains(report.String(), "FAIL    isolation.tools.paste.disable"), "unexpected report:\n%s", report)
+
+	profile.Apply(doc)
+	assert(t, profile.Audit(doc).Passed(), "report should pass after applying the profile")
+	value, _ := doc.Get("isolation.tools.copy.disable")
+	equals(t, "true", value)
+}
+
+func TestHardeningVM(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join(".", "fixtures", "b.vmx"))
+	ok(t, err)
+
+	for _, profile := range HardeningProfiles() {
+		vm := new(VirtualMachine)
+		ok(t, Unmarshal(data, vm))
+
+		report, err := profile.AuditVM(vm)
+		ok(t, err)
+		assert(t, !report.Passed(), "%s: fixture should not pass", profile.Name)
+
+		ok(t, profile.ApplyVM(vm))
+		report, err = profile.AuditVM(vm)
+		ok(t, err)
+		assert(t, report.Passed(), "%s: failed controls: %+v", profile.Name, report.Failed())
+
+		// Settings not covered by the profile are left alone.
+		equals(t, "core01", vm.DisplayName)
+		equals(t, 3, len(vm.Ethernet))
+	}
+}
@@ -0,0 +1,268 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+const isoSectorSize = 2048
+
+// Layout of the images written by writeISO: system area, primary and
+// Joliet volume descriptors, terminator, path tables and root
+// directories, then file data.
+const (
+	isoPrimarySector    = 16
+	isoJolietSector     = 17
+	isoTerminatorSector = 18
+	isoPathTableSector  = 19
+	isoRootSector       = 23
+	isoDataSector       = 25
+)
+
+// isoFile is a file in the root directory of an ISO image.
+type isoFile struct {
+	// Joliet name, as shown by operating systems supporting it
+	name string
+	data []byte
+	// Sector of the data
+	sector uint32
+}
+
+// Sorts files by their Joliet name or, if names is not nil, by their
+// name in names.
+type byISOName struct {
+	files []*isoFile
+	names map[*isoFile]string
+}
+
+func (s byISOName) Len() int      { return len(s.files) }
+func (s byISOName) Swap(i, j int) { s.files[i], s.files[j] = s.files[j], s.files[i] }
+func (s byISOName) Less(i, j int) bool {
+	if s.names != nil {
+		return s.names[s.files[i]] < s.names[s.files[j]]
+	}
+	return s.files[i].name < s.files[j].name
+}
+
+// Writes to w an ISO 9660 image, with Joliet extensions, holding files in
+// its root directory. Names are kept as they are in the Joliet directory
+// and truncated to ISO 9660 level 1 names, such as USER_DAT.;1, in the
+// primary one.
+func writeISO(w io.Writer, label string, files map[string][]byte) error {
+	var entries []*isoFile
+	for name, data := range files {
+		entries = append(entries, &isoFile{name: name, data: data})
+	}
+	sort.Sort(byISOName{entries, nil})
+
+	// Level 1 names must be unique once truncated.
+	primaryNames := make(map[*isoFile]string)
+	seen := make(map[string]bool)
+	for _, f := range entries {
+		name := isoLevel1Name(f.name)
+		if seen[name] {
+			return fmt.Errorf("ISO file names collide: %s", name)
+		}
+		seen[name] = true
+		primaryNames[f] = name
+	}
+
+	sector := uint32(isoDataSector)
+	for _, f := range entries {
+		// Empty files have no data, their extent points at sector 0
+		// rather than past the end of the image.
+		if len(f.data) == 0 {
+			f.sector = 0
+			continue
+		}
+		f.sector = sector
+		sector += uint32((len(f.data) + isoSectorSize - 1) / isoSectorSize)
+	}
+	totalSectors := sector
+
+	primary := make([]*isoFile, len(entries))
+	copy(primary, entries)
+	sort.Sort(byISOName{primary, primaryNames})
+
+	var primaryRoot, jolietRoot bytes.Buffer
+	primaryRoot.Write(isoDirRecord([]byte{0}, isoRootSector, isoSectorSize, true))
+	primaryRoot.Write(isoDirRecord([]byte{1}, isoRootSector, isoSectorSize, true))
+	for _, f := range primary {
+		primaryRoot.Write(isoDirRecord([]byte(primaryNames[f]), f.sector, uint32(len(f.data)), false))
+	}
+	jolietRoot.Write(isoDirRecord([]byte{0}, isoRootSector+1, isoSectorSize, true))
+	jolietRoot.Write(isoDirRecord([]byte{1}, isoRootSector+1, isoSectorSize, true))
+	for _, f := range entries {
+		jolietRoot.Write(isoDirRecord(ucs2(f.name), f.sector, uint32(len(f.data)), false))
+	}
+	if primaryRoot.Len() > isoSectorSize || jolietRoot.Len() > isoSectorSize {
+		return fmt.Errorf("too many files for an ISO root directory: %d", len(entries))
+	}
+
+	image := make([]byte, isoDataSector*isoSectorSize)
+	sectorAt := func(n int) []byte {
+		return image[n*isoSectorSize : (n+1)*isoSectorSize]
+	}
+
+	isoVolumeDescriptor(sectorAt(isoPrimarySector), 1, label, totalSectors, isoRootSector, isoPathTableSector)
+	isoVolumeDescriptor(sectorAt(isoJolietSector), 2, label, totalSectors, isoRootSector+1, isoPathTableSector+2)
+	terminator := sectorAt(isoTerminatorSector)
+	terminator[0] = 255
+	copy(terminator[1:], "CD001")
+	terminator[6] = 1
+
+	// Path tables, in little and big endian, of the primary and Joliet
+	// hierarchies. Both only have a root directory.
+	for i, root := range []uint32{isoRootSector, isoRootSector, isoRootSector + 1, isoRootSector + 1} {
+		table := sectorAt(isoPathTableSector + i)
+		table[0] = 1
+		if i%2 == 0 {
+			binary.LittleEndian.PutUint32(table[2:], root)
+			binary.LittleEndian.PutUint16(table[6:], 1)
+		} else {
+			binary.BigEndian.PutUint32(table[2:], root)
+			binary.BigEndian.PutUint16(table[6:], 1)
+		}
+	}
+
+	copy(sectorAt(isoRootSector), primaryRoot.Bytes())
+	copy(sectorAt(isoRootSector+1), jolietRoot.Bytes())
+
+	if _, err := w.Write(image); err != nil {
+		return err
+	}
+	for _, f := range entries {
+		padded := make([]byte, (len(f.data)+isoSectorSize-1)/isoSectorSize*isoSectorSize)
+		copy(padded, f.data)
+		if _, err := w.Write(padded); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Size of the path tables, which only hold the root directory.
+const isoPathTableSize = 10
+
+// Fills a primary (1) or Joliet supplementary (2) volume descriptor.
+func isoVolumeDescriptor(b []byte, kind byte, label string, sectors, root, pathTable uint32) {
+	b[0] = kind
+	copy(b[1:], "CD001")
+	b[6] = 1
+
+	text := func(offset, size int, s string) {
+		if kind == 2 {
+			field := b[offset : offset+size]
+			for i := 0; i+1 < size; i += 2 {
+				field[i], field[i+1] = 0, ' '
+			}
+			copy(field, ucs2(s))
+			return
+		}
+		copy(b[offset:offset+size], fmt.Sprintf("%-*s", size, strings.ToUpper(s)))
+	}
+
+	text(8, 32, "")
+	text(40, 32, label)
+	if kind == 2 {
+		// Joliet level 3
+		copy(b[88:], "%/E")
+	}
+	putBothEndian32(b[80:], sectors)
+	putBothEndian16(b[120:], 1)
+	putBothEndian16(b[124:], 1)
+	putBothEndian16(b[128:], isoSectorSize)
+	putBothEndian32(b[132:], isoPathTableSize)
+	binary.LittleEndian.PutUint32(b[140:], pathTable)
+	binary.BigEndian.PutUint32(b[148:], pathTable+1)
+	copy(b[156:], isoDirRecord([]byte{0}, root, isoSectorSize, true))
+
+	// Volume set, publisher, data preparer, application, copyright,
+	// abstract and bibliographic identifiers
+	text(190, 128, "")
+	text(318, 128, "")
+	text(446, 128, "")
+	text(574, 128, "")
+	text(702, 37, "")
+	text(739, 37, "")
+	text(776, 37, "")
+
+	// Creation, modification, expiration and effective dates, not set
+	for offset := 813; offset < 881; offset += 17 {
+		copy(b[offset:], "0000000000000000")
+	}
+	b[881] = 1
+}
+
+// Returns a directory record. Dates are left unset so that images are
+// reproducible.
+func isoDirRecord(id []byte, sector, size uint32, dir bool) []byte {
+	length := 33 + len(id)
+	if length%2 != 0 {
+		length++
+	}
+
+	r := make([]byte, length)
+	r[0] = byte(length)
+	putBothEndian32(r[2:], sector)
+	putBothEndian32(r[10:], size)
+	if dir {
+		r[25] = 2
+	}
+	putBothEndian16(r[28:], 1)
+	r[32] = byte(len(id))
+	copy(r[33:], id)
+	return r
+}
+
+// Returns an ISO 9660 level 1 file name: up to 8 upper case letters,
+// digits or underscores, an extension of up to 3 and the version.
+func isoLevel1Name(name string) string {
+	base, ext := name, ""
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		base, ext = name[:i], name[i+1:]
+	}
+
+	clean := func(s string, max int) string {
+		var b bytes.Buffer
+		for _, c := range strings.ToUpper(s) {
+			if b.Len() == max {
+				break
+			}
+			if 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+				b.WriteRune(c)
+			} else {
+				b.WriteByte('_')
+			}
+		}
+		return b.String()
+	}
+	return clean(base, 8) + "." + clean(ext, 3) + ";1"
+}
+
+// Encodes s in UCS-2, big endian, as Joliet requires.
+func ucs2(s string) []byte {
+	var b []byte
+	for _, c := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(c>>8), byte(c))
+	}
+	return b
+}
+
+func putBothEndian16(b []byte, v uint16) {
+	binary.LittleEndian.PutUint16(b, v)
+	binary.BigEndian.PutUint16(b[2:], v)
+}
+
+func putBothEndian32(b []byte, v uint32) {
+	binary.LittleEndian.PutUint32(b, v)
+	binary.BigEndian.PutUint32(b[4:], v)
+}
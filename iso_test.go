@@ -0,0 +1,81 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// Returns the name, sector and size of the files in the root directory
+// of the volume described at sector n of image.
+func readISORoot(t *testing.T, image []byte, n int) map[string][2]uint32 {
+	vd := image[n*isoSectorSize:]
+	root := binary.LittleEndian.Uint32(vd[156+2:])
+	dir := image[int(root)*isoSectorSize:]
+
+	files := make(map[string][2]uint32)
+	for offset := 0; dir[offset] != 0; offset += int(dir[offset]) {
+		r := dir[offset:]
+		id := r[33 : 33+r[32]]
+		if r[25]&2 != 0 {
+			continue
+		}
+		name := string(id)
+		if vd[0] == 2 {
+			var runes []rune
+			for i := 0; i+1 < len(id); i += 2 {
+				runes = append(runes, rune(id[i])<<8|rune(id[i+1]))
+			}
+			name = string(runes)
+		}
+		files[name] = [2]uint32{binary.LittleEndian.Uint32(r[2:]), binary.LittleEndian.Uint32(r[10:])}
+	}
+	return files
+}
+
+func TestWriteISO(t *testing.T) {
+	var b bytes.Buffer
+	ok(t, writeISO(&b, "cidata", map[string][]byte{
+		"user-data": []byte("#cloud-config\n"),
+		"meta-data": bytes.Repeat([]byte("a"), isoSectorSize+1),
+	}))
+	image := b.Bytes()
+	equals(t, 0, len(image)%isoSectorSize)
+	equals(t, uint32(len(image)/isoSectorSize), binary.LittleEndian.Uint32(image[isoPrimarySector*isoSectorSize+80:]))
+
+	primary := image[isoPrimarySector*isoSectorSize:]
+	equals(t, "CD001", string(primary[1:6]))
+	equals(t, "CIDATA", string(bytes.TrimRight(primary[40:72], " ")))
+	joliet := image[isoJolietSector*isoSectorSize:]
+	equals(t, byte(2), joliet[0])
+	equals(t, ucs2("cidata"), joliet[40:52])
+
+	equals(t, map[string][2]uint32{
+		"META_DAT.;1": {isoDataSector, isoSectorSize + 1},
+		"USER_DAT.;1": {isoDataSector + 2, 14},
+	}, readISORoot(t, image, isoPrimarySector))
+
+	files := readISORoot(t, image, isoJolietSector)
+	userData := files["user-data"]
+	equals(t, "#cloud-config\n", string(image[userData[0]*isoSectorSize:][:userData[1]]))
+
+	// Empty files do not point past the end of the image.
+	b.Reset()
+	ok(t, writeISO(&b, "cidata", map[string][]byte{"meta-data": []byte("{}"), "user-data": nil}))
+	equals(t, map[string][2]uint32{
+		"meta-data": {isoDataSector, 2},
+		"user-data": {0, 0},
+	}, readISORoot(t, b.Bytes(), isoJolietSector))
+
+	err := writeISO(&b, "cidata", map[string][]byte{"user-data-1": nil, "user-data-2": nil})
+	assert(t, err != nil, "expected error for colliding names")
+}
+
+func TestISOLevel1Name(t *testing.T) {
+	equals(t, "META_DAT.;1", isoLevel1Name("meta-data"))
+	equals(t, "NETWORK_.;1", isoLevel1Name("network-config"))
+	equals(t, "README.TXT;1", isoLevel1Name("readme.txt"))
+}
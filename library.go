@@ -0,0 +1,364 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Keys of library items and index entries, as in vmlist1.config or
+// index0.field0.name.
+var (
+	libraryItemRe  = regexp.MustCompile(`(?i)^vmlist(\d+)\.(.+)$`)
+	libraryIndexRe = regexp.MustCompile(`(?i)^index(\d+)\.(.+)$`)
+)
+
+// Library is the list of VMs known to VMware Workstation, stored in
+// inventory.vmls. It uses the VMX syntax, with an item per VM or folder:
+//
+//	vmlist1.config = "/home/me/vmware/core01/core01.vmx"
+//	vmlist1.DisplayName = "core01"
+//
+// Workstation also caches some settings of each VM in index entries,
+// which are regenerated when missing.
+type Library struct {
+	Items []*LibraryItem
+	doc   *Document
+}
+
+// LibraryItem is a VM, or a folder, of the library.
+type LibraryItem struct {
+	// N in vmlistN
+	Index int
+	// Path of the VMX file, or folderN for folders
+	Config      string
+	DisplayName string
+	// ItemID of the folder holding the item, 0 for the root
+	ParentID int
+	ItemID   int
+	// Position of the item within its folder
+	SeqID      int
+	IsFavorite bool
+	IsClone    bool
+	CfgVersion string
+	// normal, or broken when the VMX file is missing
+	State string
+	UUID  string
+	// Other keys of the item, such as Type or Expanded for folders, by
+	// name without the vmlistN prefix.
+	Extra map[string]string
+	// Keys read from the file, lowercased. Fields with the zero value
+	// are written only if they were read, so that unchanged items are
+	// written as they were.
+	read map[string]bool
+}
+
+// IsFolder reports whether the item is a folder instead of a VM.
+func (i LibraryItem) IsFolder() bool {
+	return strings.HasPrefix(strings.ToLower(i.Config), "folder")
+}
+
+// Returns the entries of the item, without the vmlistN prefix, with the
+// casing used by Workstation.
+func (i LibraryItem) entries() []Entry {
+	entries := []Entry{
+		{Key: "config", Value: i.Config},
+		{Key: "DisplayName", Value: i.DisplayName},
+		{Key: "ParentID", Value: strconv.Itoa(i.ParentID)},
+		{Key: "ItemID", Value: strconv.Itoa(i.ItemID)},
+		{Key: "SeqID", Value: strconv.Itoa(i.SeqID)},
+		{Key: "IsFavorite", Value: formatBool(i.IsFavorite)},
+		{Key: "IsClone", Value: formatBool(i.IsClone)},
+		{Key: "CfgVersion", Value: i.CfgVersion},
+		{Key: "State", Value: i.State},
+		{Key: "UUID", Value: i.UUID},
+	}
+
+	extra := make([]string, 0, len(i.Extra))
+	for k := range i.Extra {
+		extra = append(extra, k)
+	}
+	sort.Strings(extra)
+	for _, k := range extra {
+		entries = append(entries, Entry{Key: k, Value: i.Extra[k]})
+	}
+
+	var written []Entry
+	for _, e := range entries {
+		if e.Value == "" {
+			continue
+		}
+		if i.read != nil && !i.read[strings.ToLower(e.Key)] && (e.Value == "0" || e.Value == "FALSE") {
+			continue
+		}
+		written = append(written, e)
+	}
+	return written
+}
+
+func (i *LibraryItem) set(name, value string) {
+	if i.read == nil {
+		i.read = make(map[string]bool)
+	}
+	i.read[strings.ToLower(name)] = true
+
+	switch strings.ToLower(name) {
+	case "config":
+		i.Config = value
+	case "displayname":
+		i.DisplayName = value
+	case "parentid":
+		i.ParentID, _ = strconv.Atoi(value)
+	case "itemid":
+		i.ItemID, _ = strconv.Atoi(value)
+	case "seqid":
+		i.SeqID, _ = strconv.Atoi(value)
+	case "isfavorite":
+		i.IsFavorite = strings.EqualFold(value, "true")
+	case "isclone":
+		i.IsClone = strings.EqualFold(value, "true")
+	case "cfgversion":
+		i.CfgVersion = value
+	case "state":
+		i.State = value
+	case "uuid":
+		i.UUID = value
+	default:
+		if i.Extra == nil {
+			i.Extra = make(map[string]string)
+		}
+		i.Extra[name] = value
+	}
+}
+
+func formatBool(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// ParseLibrary parses an inventory.vmls file.
+func ParseLibrary(r io.Reader) (*Library, error) {
+	doc, err := ParseDocument(r)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make(map[int]*LibraryItem)
+	for _, e := range doc.uniqueEntries() {
+		m := libraryItemRe.FindStringSubmatch(e.Key)
+		if m == nil {
+			continue
+		}
+
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid item: %s", e.Line, e.Key)
+		}
+		item := items[n]
+		if item == nil {
+			item = &LibraryItem{Index: n}
+			items[n] = item
+		}
+		item.set(m[2], e.Value)
+	}
+
+	lib := &Library{doc: doc}
+	for _, item := range items {
+		lib.Items = append(lib.Items, item)
+	}
+	sort.Sort(byIndex(lib.Items))
+	return lib, nil
+}
+
+// Sorts library items by index.
+type byIndex []*LibraryItem
+
+func (items byIndex) Len() int           { return len(items) }
+func (items byIndex) Swap(i, j int)      { items[i], items[j] = items[j], items[i] }
+func (items byIndex) Less(i, j int) bool { return items[i].Index < items[j].Index }
+
+// ReadLibrary reads the inventory.vmls file at path.
+func ReadLibrary(path string) (*Library, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseLibrary(f)
+}
+
+// WriteLibrary writes lib to the inventory.vmls file at path. See
+// WriteFile.
+func WriteLibrary(path string, lib *Library, opts *WriteOptions) error {
+	return WriteFile(path, lib.Document(), opts)
+}
+
+// Find returns the item of the VM whose VMX file is at config, or nil.
+func (l *Library) Find(config string) *LibraryItem {
+	for _, item := range l.Items {
+		if !item.IsFolder() && samePath(item.Config, config) {
+			return item
+		}
+	}
+	return nil
+}
+
+// Library files may come from Windows hosts, where paths are case
+// insensitive and use backslashes.
+func samePath(a, b string) bool {
+	clean := func(p string) string {
+		return filepath.Clean(strings.Replace(p, `\`, "/", -1))
+	}
+	return strings.EqualFold(clean(a), clean(b))
+}
+
+// Register adds the VM whose VMX file is at config to the root of the
+// library, returning its item. VMs already registered are left as they
+// are.
+func (l *Library) Register(config, displayName string) *LibraryItem {
+	if item := l.Find(config); item != nil {
+		return item
+	}
+
+	index, itemID, seqID := 0, 0, -1
+	for _, item := range l.Items {
+		if item.Index > index {
+			index = item.Index
+		}
+		if item.ItemID > itemID {
+			itemID = item.ItemID
+		}
+		if item.ParentID == 0 && item.SeqID > seqID {
+			seqID = item.SeqID
+		}
+	}
+
+	item := &LibraryItem{
+		Index:       index + 1,
+		Config:      config,
+		DisplayName: displayName,
+		ItemID:      itemID + 1,
+		SeqID:       seqID + 1,
+		CfgVersion:  "8",
+		State:       "normal",
+		Extra:       map[string]string{"IsCfgPathNormalized": "TRUE"},
+	}
+	l.Items = append(l.Items, item)
+	return item
+}
+
+// Unregister removes the VM whose VMX file is at config from the library,
+// along with its index entries. It reports whether the VM was found.
+func (l *Library) Unregister(config string) bool {
+	found := false
+	items := l.Items[:0]
+	for _, item := range l.Items {
+		if !item.IsFolder() && samePath(item.Config, config) {
+			found = true
+			continue
+		}
+		items = append(items, item)
+	}
+	l.Items = items
+
+	if found {
+		l.removeIndex(config)
+	}
+	return found
+}
+
+// Removes the index entries of config, renumbering the ones left so that
+// they stay consecutive.
+func (l *Library) removeIndex(config string) {
+	if l.doc == nil {
+		return
+	}
+
+	groups := make(map[int][]Entry)
+	for _, e := range l.doc.uniqueEntries() {
+		if m := libraryIndexRe.FindStringSubmatch(e.Key); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			groups[n] = append(groups[n], Entry{Key: m[2], Value: e.Value})
+		}
+	}
+
+	numbers := make([]int, 0, len(groups))
+	for n := range groups {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+
+	next := 0
+	for _, n := range numbers {
+		removed := false
+		for _, e := range groups[n] {
+			if strings.EqualFold(e.Key, "id") && samePath(e.Value, config) {
+				removed = true
+			}
+		}
+
+		if removed || n != next {
+			for _, e := range groups[n] {
+				l.doc.Unset(fmt.Sprintf("index%d.%s", n, e.Key))
+			}
+		}
+		if removed {
+			continue
+		}
+
+		if n != next {
+			for _, e := range groups[n] {
+				l.doc.Set(fmt.Sprintf("index%d.%s", next, e.Key), e.Value)
+			}
+		}
+		next++
+	}
+
+	if _, found := l.doc.Get("index.count"); found {
+		l.doc.Set("index.count", strconv.Itoa(next))
+	}
+}
+
+// Document returns the library as a VMX document. Entries other than
+// items, including comments, are kept as they were read.
+func (l *Library) Document() *Document {
+	doc := new(Document)
+	if l.doc != nil {
+		doc = l.doc.Copy()
+	}
+
+	var want []Entry
+	wanted := make(map[string]bool)
+	for _, item := range l.Items {
+		for _, e := range item.entries() {
+			e.Key = fmt.Sprintf("vmlist%d.%s", item.Index, e.Key)
+			want = append(want, e)
+			wanted[strings.ToLower(e.Key)] = true
+		}
+	}
+
+	for _, e := range doc.Entries() {
+		if libraryItemRe.MatchString(e.Key) && !wanted[strings.ToLower(e.Key)] {
+			doc.Unset(e.Key)
+		}
+	}
+	for _, e := range want {
+		doc.Set(e.Key, e.Value)
+	}
+	return doc
+}
+
+// Bytes returns the contents of the inventory.vmls file.
+func (l *Library) Bytes() []byte {
+	return l.Document().Bytes()
+}
@@ -0,0 +1,96 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"strings"
+	"testing"
+)
+
+const testLibrary = `.encoding = "UTF-8"
+vmlist1.config = "folder0"
+vmlist1.Type = "2"
+vmlist1.DisplayName = "Lab"
+vmlist1.ParentID = "0"
+vmlist1.ItemID = "1"
+vmlist1.SeqID = "0"
+vmlist2.config = "C:\VMs\core01\core01.vmx"
+vmlist2.DisplayName = "core01"
+vmlist2.ParentID = "1"
+vmlist2.ItemID = "2"
+vmlist2.SeqID = "0"
+vmlist2.IsFavorite = "TRUE"
+vmlist2.IsClone = "FALSE"
+vmlist2.CfgVersion = "8"
+vmlist2.State = "normal"
+vmlist2.UUID = "56 4d 12 34"
+index0.field0.name = "guest"
+index0.field0.value = "ubuntu-64"
+index0.id = "C:\VMs\core01\core01.vmx"
+index1.field0.name = "guest"
+index1.field0.value = "windows9-64"
+index1.id = "C:\VMs\win10\win10.vmx"
+index.count = "2"
+`
+
+func TestParseLibrary(t *testing.T) {
+	lib, err := ParseLibrary(strings.NewReader(testLibrary))
+	ok(t, err)
+	equals(t, 2, len(lib.Items))
+
+	folder := lib.Items[0]
+	assert(t, folder.IsFolder(), "vmlist1 should be a folder")
+	equals(t, "Lab", folder.DisplayName)
+	equals(t, "2", folder.Extra["Type"])
+
+	vm := lib.Find(`c:/vms/core01/core01.vmx`)
+	assert(t, vm != nil, "core01 should be found")
+	equals(t, 2, vm.Index)
+	equals(t, 1, vm.ParentID)
+	equals(t, true, vm.IsFavorite)
+	equals(t, "56 4d 12 34", vm.UUID)
+
+	// Unchanged libraries are written as they were read.
+	equals(t, testLibrary, string(lib.Bytes()))
+}
+
+func TestLibraryRegister(t *testing.T) {
+	lib, err := ParseLibrary(strings.NewReader(testLibrary))
+	ok(t, err)
+
+	item := lib.Register(`C:\VMs\win10\win10.vmx`, "win10")
+	equals(t, 3, item.Index)
+	equals(t, 3, item.ItemID)
+	equals(t, 1, item.SeqID)
+	assert(t, item == lib.Register(`C:\VMs\win10\win10.vmx`, "win10"), "expected the registered item")
+
+	assert(t, lib.Unregister(`C:\VMs\core01\core01.vmx`), "core01 should be unregistered")
+	assert(t, !lib.Unregister(`C:\VMs\core01\core01.vmx`), "core01 was already unregistered")
+
+	// Items stay editable through the returned pointer.
+	item.IsFavorite = true
+
+	equals(t, `.encoding = "UTF-8"
+vmlist1.config = "folder0"
+vmlist1.Type = "2"
+vmlist1.DisplayName = "Lab"
+vmlist1.ParentID = "0"
+vmlist1.ItemID = "1"
+vmlist1.SeqID = "0"
+index.count = "1"
+index0.field0.name = "guest"
+index0.field0.value = "windows9-64"
+index0.id = "C:\VMs\win10\win10.vmx"
+vmlist3.config = "C:\VMs\win10\win10.vmx"
+vmlist3.DisplayName = "win10"
+vmlist3.ParentID = "0"
+vmlist3.ItemID = "3"
+vmlist3.SeqID = "1"
+vmlist3.IsFavorite = "TRUE"
+vmlist3.IsClone = "FALSE"
+vmlist3.CfgVersion = "8"
+vmlist3.State = "normal"
+vmlist3.IsCfgPathNormalized = "TRUE"
+`, string(lib.Bytes()))
+}
@@ -0,0 +1,331 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Severity of a lint finding. Values match SARIF levels.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityNote    Severity = "note"
+)
+
+// Finding is a problem reported by a lint rule.
+type Finding struct {
+	Rule     string
+	Severity Severity
+	// Key the finding is about. It may not be present in the file, for
+	// instance when a setting is missing.
+	Key string
+	// Line of Key in the file, 0 if it is not present.
+	Line    int
+	Message string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%d: [%s] %s: %s", f.Line, f.Rule, f.Severity, f.Message)
+}
+
+// LintRule is a best-practice check run by Lint.
+type LintRule struct {
+	ID       string
+	Severity Severity
+	// Short description of what the rule checks.
+	Description string
+	check       func(doc *Document) []Finding
+}
+
+var lintRules = []LintRule{
+	{
+		ID:          "VMX001",
+		Severity:    SeverityError,
+		Description: "VNC is enabled without a password",
+		check: func(doc *Document) []Finding {
+			e, found := doc.entry("RemoteDisplay.vnc.enabled")
+			if !found || !strings.EqualFold(e.Value, "true") {
+				return nil
+			}
+			if hasValue(doc, "RemoteDisplay.vnc.password") || hasValue(doc, "RemoteDisplay.vnc.key") {
+				return nil
+			}
+			return []Finding{{Key: e.Key, Line: e.Line, Message: "VNC is enabled without a password, anyone reaching the port controls the VM"}}
+		},
+	},
+	{
+		ID:          "VMX002",
+		Severity:    SeverityWarning,
+		Description: "Copying from the guest to the host clipboard is allowed",
+		check: func(doc *Document) []Finding {
+			e, found := doc.entry("isolation.tools.copy.disable")
+			if found && strings.EqualFold(e.Value, "true") {
+				return nil
+			}
+			if !found {
+				e.Key = "isolation.tools.copy.disable"
+			}
+			return []Finding{{Key: e.Key, Line: e.Line, Message: "isolation.tools.copy.disable is not set to TRUE, the guest can copy data to the host clipboard"}}
+		},
+	},
+	{
+		ID:          "VMX003",
+		Severity:    SeverityWarning,
+		Description: "A device refers to an absolute host path",
+		check: func(doc *Document) []Finding {
+			var findings []Finding
+			for _, e := range doc.uniqueEntries() {
+				if DeviceOf(e.Key) == "" || !strings.HasSuffix(strings.ToLower(e.Key), ".filename") {
+					continue
+				}
+				if isAbsHostPath(e.Value) {
+					findings = append(findings, Finding{Key: e.Key, Line: e.Line, Message: fmt.Sprintf("%s is an absolute host path, the VM will break when moved to another host or directory", e.Value)})
+				}
+			}
+			return findings
+		},
+	},
+	{
+		ID:          "VMX004",
+		Severity:    SeverityNote,
+		Description: "A 64-bit guest uses an emulated e1000 NIC",
+		check: func(doc *Document) []Finding {
+			guestOS, _ := doc.Get("guestOS")
+			if !strings.HasSuffix(strings.ToLower(guestOS), "-64") {
+				return nil
+			}
+
+			var findings []Finding
+			for _, e := range doc.uniqueEntries() {
+				device := DeviceOf(e.Key)
+				if !strings.HasPrefix(device, "ethernet") || !strings.EqualFold(e.Key[len(device):], ".virtualDev") {
+					continue
+				}
+				if v := strings.ToLower(e.Value); v == "e1000" || v == "e1000e" {
+					findings = append(findings, Finding{Key: e.Key, Line: e.Line, Message: fmt.Sprintf("%s emulates an %s, vmxnet3 performs better on %s guests", device, e.Value, guestOS)})
+				}
+			}
+			return findings
+		},
+	},
+	{
+		ID:          "VMX005",
+		Severity:    SeverityWarning,
+		Description: "Questions from VMware are answered automatically",
+		check: func(doc *Document) []Finding {
+			e, found := doc.entry("msg.autoAnswer")
+			if !found || !strings.EqualFold(e.Value, "true") {
+				return nil
+			}
+			return []Finding{{Key: e.Key, Line: e.Line, Message: "msg.autoAnswer is enabled, questions such as whether the VM was moved or copied will be answered with their defaults"}}
+		},
+	},
+	{
+		ID:          "VMX006",
+		Severity:    SeverityWarning,
+		Description: "A shared folder is writable from the guest",
+		check: func(doc *Document) []Finding {
+			var findings []Finding
+			for _, e := range doc.uniqueEntries() {
+				device := DeviceOf(e.Key)
+				if !strings.HasPrefix(device, "sharedfolder") || !strings.EqualFold(e.Key[len(device):], ".writeAccess") {
+					continue
+				}
+				if !strings.EqualFold(e.Value, "true") {
+					continue
+				}
+				if present, _ := doc.Get(device + ".present"); strings.EqualFold(present, "false") {
+					continue
+				}
+				hostPath, _ := doc.Get(device + ".hostPath")
+				findings = append(findings, Finding{Key: e.Key, Line: e.Line, Message: fmt.Sprintf("%s gives the guest write access to %s", device, hostPath)})
+			}
+			return findings
+		},
+	},
+}
+
+// LintRules returns the rules run by Lint.
+func LintRules() []LintRule {
+	rules := make([]LintRule, len(lintRules))
+	copy(rules, lintRules)
+	return rules
+}
+
+func findLintRule(id string) *LintRule {
+	for i := range lintRules {
+		if strings.EqualFold(lintRules[i].ID, id) {
+			return &lintRules[i]
+		}
+	}
+	return nil
+}
+
+// LintConfig customizes which rules Lint runs and how their findings
+// are reported.
+type LintConfig struct {
+	// Rules that are not run.
+	Disabled map[string]bool
+	// Severity overrides, by rule.
+	Severity map[string]Severity
+	// Glob patterns, by rule, of files the rule does not apply to.
+	Ignore map[string][]string
+}
+
+// ParseLintConfig reads a lint configuration. It uses the VMX syntax,
+// with keys made of a rule ID and an option:
+//
+//	# Do not run VMX004 at all
+//	VMX004.enabled = "FALSE"
+//	# Report VMX002 as an error
+//	VMX002.severity = "error"
+//	# Templates are allowed to use absolute paths
+//	VMX003.ignore = "templates/*.vmx, base/*.vmx"
+func ParseLintConfig(r io.Reader) (*LintConfig, error) {
+	doc, err := ParseDocument(r)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &LintConfig{
+		Disabled: make(map[string]bool),
+		Severity: make(map[string]Severity),
+		Ignore:   make(map[string][]string),
+	}
+
+	var errors []string
+	for _, e := range doc.Entries() {
+		i := strings.Index(e.Key, ".")
+		if i < 0 {
+			errors = append(errors, fmt.Sprintf("line %d: expected <rule>.<option>: %s", e.Line, e.Key))
+			continue
+		}
+
+		rule := findLintRule(e.Key[:i])
+		if rule == nil {
+			errors = append(errors, fmt.Sprintf("line %d: unknown rule: %s", e.Line, e.Key[:i]))
+			continue
+		}
+
+		switch option := strings.ToLower(e.Key[i+1:]); option {
+		case "enabled":
+			config.Disabled[rule.ID] = strings.EqualFold(e.Value, "false")
+		case "severity":
+			severity := Severity(strings.ToLower(e.Value))
+			switch severity {
+			case SeverityError, SeverityWarning, SeverityNote:
+				config.Severity[rule.ID] = severity
+			default:
+				errors = append(errors, fmt.Sprintf("line %d: unknown severity: %s", e.Line, e.Value))
+			}
+		case "ignore":
+			for _, pattern := range strings.Split(e.Value, ",") {
+				pattern = strings.TrimSpace(pattern)
+				if _, err := filepath.Match(pattern, ""); err != nil {
+					errors = append(errors, fmt.Sprintf("line %d: invalid pattern %s: %v", e.Line, pattern, err))
+					continue
+				}
+				config.Ignore[rule.ID] = append(config.Ignore[rule.ID], pattern)
+			}
+		default:
+			errors = append(errors, fmt.Sprintf("line %d: unknown option: %s", e.Line, option))
+		}
+	}
+
+	if len(errors) > 0 {
+		return nil, &Error{errors}
+	}
+	return config, nil
+}
+
+// Reports whether the findings of rule are ignored for the file at path.
+func (c *LintConfig) ignores(rule, path string) bool {
+	if c == nil || path == "" {
+		return false
+	}
+
+	slashed := filepath.ToSlash(filepath.Clean(path))
+	for _, pattern := range c.Ignore[rule] {
+		for _, p := range []string{slashed, filepath.Base(path)} {
+			if matched, _ := filepath.Match(pattern, p); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Lint runs every enabled rule against doc. Findings are sorted by line.
+// A nil config runs all rules with their default severity.
+func Lint(doc *Document, config *LintConfig) []Finding {
+	return lint(doc, config, "")
+}
+
+// LintFile parses and lints the VMX file at path, honoring the ignore
+// patterns in config.
+func LintFile(path string, config *LintConfig) ([]Finding, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	doc, err := ParseDocument(f)
+	if err != nil {
+		return nil, err
+	}
+	return lint(doc, config, path), nil
+}
+
+func lint(doc *Document, config *LintConfig, path string) []Finding {
+	var findings []Finding
+	for _, rule := range lintRules {
+		if config != nil && config.Disabled[rule.ID] || config.ignores(rule.ID, path) {
+			continue
+		}
+
+		severity := rule.Severity
+		if config != nil && config.Severity[rule.ID] != "" {
+			severity = config.Severity[rule.ID]
+		}
+
+		for _, f := range rule.check(doc) {
+			f.Rule = rule.ID
+			f.Severity = severity
+			findings = append(findings, f)
+		}
+	}
+
+	sort.Stable(byLine(findings))
+	return findings
+}
+
+// Sorts findings by line.
+type byLine []Finding
+
+func (f byLine) Len() int           { return len(f) }
+func (f byLine) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+func (f byLine) Less(i, j int) bool { return f[i].Line < f[j].Line }
+
+func hasValue(doc *Document, key string) bool {
+	value, _ := doc.Get(key)
+	return value != ""
+}
+
+// Absolute paths on either Unix or Windows hosts, since VMX files are
+// often shared between them.
+func isAbsHostPath(path string) bool {
+	if strings.HasPrefix(path, "/") || strings.HasPrefix(path, `\\`) {
+		return true
+	}
+	return len(path) > 2 && path[1] == ':' && (path[2] == '\\' || path[2] == '/')
+}
@@ -0,0 +1,88 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const lintSample = `guestOS = "ubuntu-64"
+RemoteDisplay.vnc.enabled = "TRUE"
+msg.autoAnswer = "TRUE"
+ethernet0.virtualDev = "e1000"
+ethernet1.virtualDev = "vmxnet3"
+scsi0:0.fileName = "/Users/camilo/vms/disk.vmdk"
+ide1:0.fileName = "C:\ISOs\ubuntu.iso"
+scsi0:1.fileName = "disk2.vmdk"
+sharedFolder0.present = "TRUE"
+sharedFolder0.writeAccess = "TRUE"
+sharedFolder0.hostPath = "/home/camilo"
+sharedFolder1.present = "FALSE"
+sharedFolder1.writeAccess = "TRUE"
+`
+
+func TestLint(t *testing.T) {
+	doc, err := ParseDocument(strings.NewReader(lintSample))
+	ok(t, err)
+
+	findings := Lint(doc, nil)
+	var got []string
+	for _, f := range findings {
+		got = append(got, f.Rule+":"+string(f.Severity)+":"+f.Key)
+	}
+	equals(t, []string{
+		"VMX002:warning:isolation.tools.copy.disable",
+		"VMX001:error:RemoteDisplay.vnc.enabled",
+		"VMX005:warning:msg.autoAnswer",
+		"VMX004:note:ethernet0.virtualDev",
+		"VMX003:warning:scsi0:0.fileName",
+		"VMX003:warning:ide1:0.fileName",
+		"VMX006:warning:sharedFolder0.writeAccess",
+	}, got)
+	equals(t, 0, findings[0].Line)
+	equals(t, 2, findings[1].Line)
+
+	doc.Set("RemoteDisplay.vnc.key", "secret")
+	doc.Set("isolation.tools.copy.disable", "true")
+	for _, f := range Lint(doc, nil) {
+		assert(t, f.Rule != "VMX001" && f.Rule != "VMX002", "%s should not be reported", f.Rule)
+	}
+}
+
+func TestLintConfig(t *testing.T) {
+	config, err := ParseLintConfig(strings.NewReader(`# Lint settings
+VMX004.enabled = "FALSE"
+vmx002.severity = "error"
+VMX003.ignore = "templates/*.vmx, *.tpl.vmx"
+`))
+	ok(t, err)
+
+	dir, err := ioutil.TempDir("", "govmx")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "base.tpl.vmx")
+	ok(t, ioutil.WriteFile(path, []byte(lintSample), 0644))
+
+	findings, err := LintFile(path, config)
+	ok(t, err)
+	for _, f := range findings {
+		assert(t, f.Rule != "VMX004" && f.Rule != "VMX003", "%s should not be reported", f.Rule)
+		if f.Rule == "VMX002" {
+			equals(t, SeverityError, f.Severity)
+		}
+	}
+
+	_, err = ParseLintConfig(strings.NewReader("VMX999.enabled = \"FALSE\"\nVMX001.severity = \"fatal\"\nVMX001.color = \"red\"\n"))
+	assert(t, err != nil, "an error was expected")
+	equals(t, []string{
+		"line 1: unknown rule: VMX999",
+		"line 2: unknown severity: fatal",
+		"line 3: unknown option: color",
+	}, err.(*Error).Errors)
+}
@@ -0,0 +1,243 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Interval at which AcquireLock checks whether a lock was released.
+const lockPollInterval = 100 * time.Millisecond
+
+// LockInfo describes a lock file found in the lock directory of a VMX
+// file. Lock files are parsed on a best effort basis, fields not found
+// are left empty.
+type LockInfo struct {
+	// Path of the lock file
+	Path string
+	// Lock type, such as exclusive
+	Type string
+	Host string
+	PID  int
+	// Every key=value pair of the lock file
+	Fields map[string]string
+}
+
+// LockedError is returned when a VMX file is locked by a running VM or
+// another program.
+type LockedError struct {
+	Path  string
+	Locks []LockInfo
+}
+
+func (e *LockedError) Error() string {
+	var owners []string
+	for _, l := range e.Locks {
+		switch {
+		case l.Host != "" && l.PID != 0:
+			owners = append(owners, fmt.Sprintf("%s (pid %d)", l.Host, l.PID))
+		case l.Host != "":
+			owners = append(owners, l.Host)
+		case l.PID != 0:
+			owners = append(owners, fmt.Sprintf("pid %d", l.PID))
+		default:
+			owners = append(owners, filepath.Base(l.Path))
+		}
+	}
+	return fmt.Sprintf("%s is locked by %s", e.Path, strings.Join(owners, ", "))
+}
+
+// IsLocked reports whether err is a *LockedError.
+func IsLocked(err error) bool {
+	_, ok := err.(*LockedError)
+	return ok
+}
+
+// LockDir returns the lock directory of the VMX file at path, as created
+// by VMware products while the VM runs.
+func LockDir(path string) string {
+	return path + ".lck"
+}
+
+// CheckLock returns the locks held on the VMX file at path, if any.
+func CheckLock(path string) ([]LockInfo, error) {
+	dir := LockDir(path)
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var locks []LockInfo
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".lck") {
+			continue
+		}
+
+		lockPath := filepath.Join(dir, f.Name())
+		data, err := ioutil.ReadFile(lockPath)
+		if os.IsNotExist(err) {
+			// Released while we were looking.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		locks = append(locks, parseLockFile(lockPath, data))
+	}
+	return locks, nil
+}
+
+// Lock files hold key=value lines, with the host and process holding the
+// lock among them. Keys are matched loosely since they vary between
+// VMware products.
+func parseLockFile(path string, data []byte) LockInfo {
+	info := LockInfo{Path: path, Fields: make(map[string]string)}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimRight(scanner.Text(), "\x00"))
+		i := strings.Index(line, "=")
+		if i < 0 {
+			continue
+		}
+		key, value := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		info.Fields[key] = value
+
+		switch strings.ToLower(key) {
+		case "type":
+			info.Type = value
+		case "host", "hostname":
+			info.Host = value
+		case "pid":
+			info.PID, _ = strconv.Atoi(value)
+		}
+	}
+	return info
+}
+
+// Lock is a lock held on a VMX file, compatible with the ones created by
+// VMware products.
+type Lock struct {
+	path string
+	file string
+	// Whether the lock directory was created by us and has to be removed
+	// on release.
+	createdDir bool
+}
+
+// AcquireLock locks the VMX file at path, waiting up to timeout for other
+// locks to be released. It returns a *LockedError if the file is still
+// locked after timeout.
+func AcquireLock(path string, timeout time.Duration) (*Lock, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		l, err := tryLock(path)
+		if err == nil {
+			return l, nil
+		}
+		if !IsLocked(err) || !time.Now().Before(deadline) {
+			return nil, err
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+func tryLock(path string) (*Lock, error) {
+	locks, err := CheckLock(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(locks) > 0 {
+		return nil, &LockedError{Path: path, Locks: locks}
+	}
+
+	l := &Lock{path: path}
+	dir := LockDir(path)
+	if err := os.Mkdir(dir, 0755); err == nil {
+		l.createdDir = true
+	} else if !os.IsExist(err) {
+		return nil, err
+	}
+
+	host, _ := os.Hostname()
+	contents := fmt.Sprintf("type=exclusive\nhostname=%s\npid=%d\nacquireTimeStamp=%d\n",
+		host, os.Getpid(), time.Now().UnixNano())
+
+	// VMware names lock files M followed by a random number.
+	file := filepath.Join(dir, fmt.Sprintf("M%05d.lck", rand.Intn(100000)))
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		l.Release()
+		if os.IsExist(err) {
+			return nil, &LockedError{Path: path, Locks: []LockInfo{{Path: file}}}
+		}
+		return nil, err
+	}
+	l.file = file
+
+	_, err = f.WriteString(contents)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		l.Release()
+		return nil, err
+	}
+
+	// Someone else may have locked the file at the same time.
+	if others, err := l.others(); err != nil || len(others) > 0 {
+		l.Release()
+		if err != nil {
+			return nil, err
+		}
+		return nil, &LockedError{Path: path, Locks: others}
+	}
+	return l, nil
+}
+
+// Returns the locks on the file not held by l.
+func (l *Lock) others() ([]LockInfo, error) {
+	locks, err := CheckLock(l.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var others []LockInfo
+	for _, info := range locks {
+		if info.Path != l.file {
+			others = append(others, info)
+		}
+	}
+	return others, nil
+}
+
+// Release removes the lock, and the lock directory if it was created
+// when acquiring it.
+func (l *Lock) Release() error {
+	if l.file != "" {
+		if err := os.Remove(l.file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		l.file = ""
+	}
+
+	if l.createdDir {
+		// Fails if someone else locked the file meanwhile, which is fine.
+		os.Remove(LockDir(l.path))
+		l.createdDir = false
+	}
+	return nil
+}
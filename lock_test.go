@@ -0,0 +1,83 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govmx")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "core01.vmx")
+	ok(t, ioutil.WriteFile(path, []byte("displayName = \"core01\"\n"), 0644))
+
+	locks, err := CheckLock(path)
+	ok(t, err)
+	equals(t, 0, len(locks))
+
+	l, err := AcquireLock(path, 0)
+	ok(t, err)
+
+	locks, err = CheckLock(path)
+	ok(t, err)
+	equals(t, 1, len(locks))
+	equals(t, "exclusive", locks[0].Type)
+	equals(t, os.Getpid(), locks[0].PID)
+
+	_, err = AcquireLock(path, 2*lockPollInterval)
+	assert(t, IsLocked(err), "expected *LockedError, got %v", err)
+
+	// Writing is allowed to the holder of the lock only.
+	doc := new(Document)
+	doc.Set("displayName", "core02")
+	err = WriteFile(path, doc, nil)
+	assert(t, IsLocked(err), "expected *LockedError, got %v", err)
+	ok(t, WriteFile(path, doc, &WriteOptions{Lock: l}))
+
+	ok(t, l.Release())
+	_, err = os.Stat(LockDir(path))
+	assert(t, os.IsNotExist(err), "lock directory should be removed")
+
+	ok(t, WriteFile(path, doc, nil))
+}
+
+func TestLockWait(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govmx")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+
+	// A lock left by a running VM.
+	path := filepath.Join(dir, "core01.vmx")
+	ok(t, os.Mkdir(LockDir(path), 0755))
+	lockFile := filepath.Join(LockDir(path), "M31337.lck")
+	ok(t, ioutil.WriteFile(lockFile, []byte("type=exclusive\nhostname=esx01\npid=4242\n"), 0644))
+
+	locks, err := CheckLock(path)
+	ok(t, err)
+	equals(t, "esx01", locks[0].Host)
+	equals(t, 4242, locks[0].PID)
+
+	_, err = AcquireLock(path, 0)
+	assert(t, err != nil && err.Error() == path+" is locked by esx01 (pid 4242)", "unexpected error: %v", err)
+
+	go func() {
+		time.Sleep(2 * lockPollInterval)
+		os.Remove(lockFile)
+	}()
+
+	l, err := AcquireLock(path, time.Second)
+	ok(t, err)
+	ok(t, l.Release())
+
+	// The directory was not created by us, so it is kept.
+	_, err = os.Stat(LockDir(path))
+	ok(t, err)
+}
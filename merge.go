@@ -0,0 +1,128 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"strings"
+)
+
+// Conflict is a device, or a key that is not part of a device, that
+// both sides of a merge changed in different ways.
+type Conflict struct {
+	// Device in conflict, such as ethernet0, or the lowercased key when
+	// the conflict is on a standalone key.
+	Group string
+	// Entries of the group on each side of the merge. A nil slice means
+	// the group is not present on that side.
+	Base   []Entry
+	Ours   []Entry
+	Theirs []Entry
+}
+
+// Merge performs a three-way merge of VMX documents. Changes made in
+// theirs since base are applied to a copy of ours, unless ours changed the
+// same group too, in which case ours is kept and a conflict is reported.
+//
+// Devices are merged as a unit: if both sides touched ethernet1, even
+// through different keys, the whole device is in conflict, since mixing
+// the settings of two versions of a device rarely makes sense.
+func Merge(base, ours, theirs *Document) (*Document, []Conflict) {
+	merged := ours.Copy()
+
+	ourChanges := groupChanges(Diff(base, ours))
+	theirChanges := groupChanges(Diff(base, theirs))
+
+	var conflicts []Conflict
+	for _, group := range theirChanges.order {
+		if _, changed := ourChanges.changes[group]; !changed {
+			for _, c := range theirChanges.changes[group] {
+				if c.Op == Removed {
+					merged.Unset(c.Key)
+				} else {
+					merged.Set(c.Key, c.New)
+				}
+			}
+			continue
+		}
+
+		oursEntries := groupEntries(ours, group)
+		theirsEntries := groupEntries(theirs, group)
+		if equalEntries(oursEntries, theirsEntries) {
+			continue
+		}
+
+		conflicts = append(conflicts, Conflict{
+			Group:  group,
+			Base:   groupEntries(base, group),
+			Ours:   oursEntries,
+			Theirs: theirsEntries,
+		})
+	}
+
+	return merged, conflicts
+}
+
+type groupedChanges struct {
+	changes map[string][]Change
+	order   []string
+}
+
+// Groups changes by the unit they are merged as: the device or the key.
+func groupChanges(changes Changes) groupedChanges {
+	g := groupedChanges{changes: make(map[string][]Change)}
+	for _, c := range changes {
+		group := mergeGroup(c.Key)
+		if _, found := g.changes[group]; !found {
+			g.order = append(g.order, group)
+		}
+		g.changes[group] = append(g.changes[group], c)
+	}
+	return g
+}
+
+func mergeGroup(key string) string {
+	if device := DeviceOf(key); device != "" {
+		return device
+	}
+	return strings.ToLower(key)
+}
+
+// Returns the effective entries of doc that belong to group.
+func groupEntries(doc *Document, group string) []Entry {
+	var entries []Entry
+	index := make(map[string]int)
+	for _, e := range doc.Entries() {
+		if mergeGroup(e.Key) != group {
+			continue
+		}
+
+		k := strings.ToLower(e.Key)
+		if i, found := index[k]; found {
+			entries[i] = e
+			continue
+		}
+		index[k] = len(entries)
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func equalEntries(a, b []Entry) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	values := make(map[string]string)
+	for _, e := range a {
+		values[strings.ToLower(e.Key)] = e.Value
+	}
+
+	for _, e := range b {
+		value, found := values[strings.ToLower(e.Key)]
+		if !found || !equalValues(value, e.Value) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,68 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	parse := func(s string) *Document {
+		doc, err := ParseDocument(strings.NewReader(s))
+		ok(t, err)
+		return doc
+	}
+
+	base := parse(`displayName = "core01"
+memsize = "1024"
+numvcpus = "1"
+ethernet0.virtualDev = "e1000"
+ethernet0.present = "TRUE"
+ethernet1.virtualDev = "e1000"
+sound.present = "TRUE"
+`)
+
+	// Our automation bumps memory and changes ethernet1's adapter.
+	ours := parse(`displayName = "core01"
+memsize = "2048"
+numvcpus = "1"
+ethernet0.virtualDev = "e1000"
+ethernet0.present = "TRUE"
+ethernet1.virtualDev = "vmxnet3"
+sound.present = "TRUE"
+`)
+
+	// The UI adds a CPU, sets ethernet1's address, removes the sound card,
+	// tweaks ethernet0 and writes booleans in lowercase.
+	theirs := parse(`displayName = "core01"
+memsize = "1024"
+numvcpus = "2"
+ethernet0.virtualDev = "vmxnet3"
+ethernet0.present = "true"
+ethernet1.virtualDev = "e1000"
+ethernet1.address = "00:50:56:aa:bb:cc"
+`)
+
+	merged, conflicts := Merge(base, ours, theirs)
+	equals(t, `displayName = "core01"
+memsize = "2048"
+numvcpus = "2"
+ethernet0.virtualDev = "vmxnet3"
+ethernet0.present = "TRUE"
+ethernet1.virtualDev = "vmxnet3"
+`, merged.String())
+
+	equals(t, []Conflict{{
+		Group:  "ethernet1",
+		Base:   []Entry{{Key: "ethernet1.virtualDev", Value: "e1000", Line: 6}},
+		Ours:   []Entry{{Key: "ethernet1.virtualDev", Value: "vmxnet3", Line: 6}},
+		Theirs: []Entry{{Key: "ethernet1.virtualDev", Value: "e1000", Line: 6}, {Key: "ethernet1.address", Value: "00:50:56:aa:bb:cc", Line: 7}},
+	}}, conflicts)
+
+	// Both sides making the same change is not a conflict.
+	merged, conflicts = Merge(base, ours, ours)
+	equals(t, 0, len(conflicts))
+	equals(t, ours.String(), merged.String())
+}
@@ -0,0 +1,237 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PortForward forwards a port of the host to a VM behind NAT.
+type PortForward struct {
+	// tcp or udp
+	Protocol  string
+	HostPort  int
+	GuestIP   net.IP
+	GuestPort int
+}
+
+func (pf PortForward) String() string {
+	return fmt.Sprintf("%s %d -> %v:%d", pf.Protocol, pf.HostPort, pf.GuestIP, pf.GuestPort)
+}
+
+// NATConfig is the configuration of the NAT device of a virtual network,
+// nat.conf on Linux and macOS hosts or vmnetnat.conf on Windows. It is an
+// INI file, with port forwards in the incomingtcp and incomingudp
+// sections:
+//
+//	[incomingtcp]
+//	# host port = guest ip:guest port
+//	2222 = 192.168.100.10:22
+//
+// Lines that are not changed are written as they were read.
+type NATConfig struct {
+	lines []natLine
+}
+
+type natLine struct {
+	raw string
+	// Lowercased name of the section the line belongs to
+	section string
+	key     string
+	value   string
+	isEntry bool
+	dirty   bool
+}
+
+// ParseNATConfig parses a nat.conf file.
+func ParseNATConfig(r io.Reader) (*NATConfig, error) {
+	config := new(NATConfig)
+
+	var errors []string
+	section := ""
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		raw := scanner.Text()
+		line := strings.TrimSpace(raw)
+		l := natLine{raw: raw, section: section}
+
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "["):
+			if !strings.HasSuffix(line, "]") {
+				errors = append(errors, fmt.Sprintf("line %d: Invalid section: %s", lineNum, line))
+				break
+			}
+			section = strings.ToLower(strings.TrimSpace(line[1 : len(line)-1]))
+			l.section = section
+		default:
+			i := strings.Index(line, "=")
+			if i < 0 {
+				errors = append(errors, fmt.Sprintf("line %d: Invalid line: %s", lineNum, line))
+				break
+			}
+			l.key = strings.TrimSpace(line[:i])
+			l.value = strings.TrimSpace(line[i+1:])
+			l.isEntry = true
+		}
+		config.lines = append(config.lines, l)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(errors) > 0 {
+		return nil, &Error{errors}
+	}
+	return config, nil
+}
+
+// Get returns the value of key in section.
+func (c *NATConfig) Get(section, key string) (string, bool) {
+	for _, l := range c.lines {
+		if l.isEntry && strings.EqualFold(l.section, section) && strings.EqualFold(l.key, key) {
+			return l.value, true
+		}
+	}
+	return "", false
+}
+
+// Set changes the value of key in section. New keys are added at the end
+// of their section, which is created if needed.
+func (c *NATConfig) Set(section, key, value string) {
+	section = strings.ToLower(section)
+	last := -1
+	for i := range c.lines {
+		l := &c.lines[i]
+		if l.section != section {
+			continue
+		}
+		if l.isEntry && strings.EqualFold(l.key, key) {
+			if l.value != value {
+				l.value = value
+				l.dirty = true
+			}
+			return
+		}
+		if l.isEntry || strings.HasPrefix(strings.TrimSpace(l.raw), "[") {
+			last = i
+		}
+	}
+
+	entry := natLine{section: section, key: key, value: value, isEntry: true, dirty: true}
+	if last < 0 {
+		c.lines = append(c.lines, natLine{raw: "[" + section + "]", section: section}, entry)
+		return
+	}
+	c.lines = append(c.lines[:last+1], append([]natLine{entry}, c.lines[last+1:]...)...)
+}
+
+// Unset removes key from section and reports whether it was found.
+func (c *NATConfig) Unset(section, key string) bool {
+	found := false
+	lines := c.lines[:0]
+	for _, l := range c.lines {
+		if l.isEntry && strings.EqualFold(l.section, section) && strings.EqualFold(l.key, key) {
+			found = true
+			continue
+		}
+		lines = append(lines, l)
+	}
+	c.lines = lines
+	return found
+}
+
+// PortForwards returns the ports forwarded to VMs, sorted by protocol and
+// host port. Invalid entries are skipped.
+func (c *NATConfig) PortForwards() []PortForward {
+	var forwards []PortForward
+	for _, l := range c.lines {
+		if !l.isEntry || !strings.HasPrefix(l.section, "incoming") {
+			continue
+		}
+		if pf, ok := parsePortForward(strings.TrimPrefix(l.section, "incoming"), l.key, l.value); ok {
+			forwards = append(forwards, pf)
+		}
+	}
+
+	sort.Sort(byHostPort(forwards))
+	return forwards
+}
+
+// Sorts port forwards by protocol and host port.
+type byHostPort []PortForward
+
+func (f byHostPort) Len() int      { return len(f) }
+func (f byHostPort) Swap(i, j int) { f[i], f[j] = f[j], f[i] }
+func (f byHostPort) Less(i, j int) bool {
+	if f[i].Protocol != f[j].Protocol {
+		return f[i].Protocol < f[j].Protocol
+	}
+	return f[i].HostPort < f[j].HostPort
+}
+
+func parsePortForward(protocol, key, value string) (PortForward, bool) {
+	hostPort, err := strconv.Atoi(key)
+	if err != nil {
+		return PortForward{}, false
+	}
+
+	// Values may be followed by a comment.
+	if i := strings.IndexAny(value, "#;"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	host, port, err := net.SplitHostPort(value)
+	if err != nil {
+		return PortForward{}, false
+	}
+	guestPort, err := strconv.Atoi(port)
+	ip := net.ParseIP(host)
+	if err != nil || ip == nil {
+		return PortForward{}, false
+	}
+	return PortForward{Protocol: protocol, HostPort: hostPort, GuestIP: ip, GuestPort: guestPort}, true
+}
+
+// PortForward returns the forward of the given host port, or nil.
+func (c *NATConfig) PortForward(protocol string, hostPort int) *PortForward {
+	value, found := c.Get("incoming"+protocol, strconv.Itoa(hostPort))
+	if !found {
+		return nil
+	}
+	if pf, ok := parsePortForward(strings.ToLower(protocol), strconv.Itoa(hostPort), value); ok {
+		return &pf
+	}
+	return nil
+}
+
+// AddPortForward adds pf, replacing any forward of the same host port.
+func (c *NATConfig) AddPortForward(pf PortForward) {
+	c.Set("incoming"+pf.Protocol, strconv.Itoa(pf.HostPort), net.JoinHostPort(pf.GuestIP.String(), strconv.Itoa(pf.GuestPort)))
+}
+
+// RemovePortForward removes the forward of the given host port and
+// reports whether it was found.
+func (c *NATConfig) RemovePortForward(protocol string, hostPort int) bool {
+	return c.Unset("incoming"+protocol, strconv.Itoa(hostPort))
+}
+
+// Bytes returns the contents of the file.
+func (c *NATConfig) Bytes() []byte {
+	var b bytes.Buffer
+	for _, l := range c.lines {
+		if l.isEntry && (l.dirty || l.raw == "") {
+			fmt.Fprintf(&b, "%s = %s\n", l.key, l.value)
+			continue
+		}
+		b.WriteString(l.raw + "\n")
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,66 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+const testNATConfig = `# VMware NAT configuration file
+
+[host]
+ip = 192.168.100.2
+netmask = 255.255.255.0
+device = /dev/vmnet8
+
+[udp]
+timeout = 30
+
+[incomingtcp]
+# Use these with care - anyone can enter into your VM through these...
+# [host port] = [VM's IP address]:[VM's port]
+8080 = 192.168.100.50:80
+
+[incomingudp]
+`
+
+func TestParseNATConfig(t *testing.T) {
+	nat, err := ParseNATConfig(strings.NewReader(testNATConfig))
+	ok(t, err)
+
+	ip, found := nat.Get("host", "IP")
+	assert(t, found, "expected host.ip")
+	equals(t, "192.168.100.2", ip)
+
+	equals(t, []PortForward{
+		{Protocol: "tcp", HostPort: 8080, GuestIP: net.ParseIP("192.168.100.50"), GuestPort: 80},
+	}, nat.PortForwards())
+	equals(t, testNATConfig, string(nat.Bytes()))
+
+	_, err = ParseNATConfig(strings.NewReader("[host\n"))
+	assert(t, err != nil, "expected error for an invalid section")
+}
+
+func TestNATPortForwards(t *testing.T) {
+	nat, err := ParseNATConfig(strings.NewReader(testNATConfig))
+	ok(t, err)
+
+	nat.AddPortForward(PortForward{Protocol: "udp", HostPort: 5353, GuestIP: net.ParseIP("192.168.100.50"), GuestPort: 53})
+	nat.AddPortForward(PortForward{Protocol: "tcp", HostPort: 8080, GuestIP: net.ParseIP("192.168.100.51"), GuestPort: 8080})
+	equals(t, "192.168.100.51", nat.PortForward("tcp", 8080).GuestIP.String())
+	equals(t, 53, nat.PortForward("udp", 5353).GuestPort)
+
+	want := strings.Replace(testNATConfig, "8080 = 192.168.100.50:80", "8080 = 192.168.100.51:8080", 1) +
+		"5353 = 192.168.100.50:53\n"
+	equals(t, want, string(nat.Bytes()))
+
+	assert(t, nat.RemovePortForward("udp", 5353), "expected forward of udp port 5353")
+	assert(t, !nat.RemovePortForward("udp", 5353), "expected no forward of udp port 5353")
+
+	nat = new(NATConfig)
+	nat.Set("incomingtcp", "2222", "192.168.100.10:22")
+	equals(t, "[incomingtcp]\n2222 = 192.168.100.10:22\n", string(nat.Bytes()))
+}
@@ -0,0 +1,499 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Answers of the networking file, as in VNET_8_HOSTONLY_SUBNET.
+var vnetAnswerRe = regexp.MustCompile(`^VNET_(\d+)_(.+)$`)
+
+// VirtualNetwork is a host virtual network, or vmnet, as defined in the
+// networking file of Linux and macOS hosts.
+type VirtualNetwork struct {
+	// N in vmnetN
+	Number int
+	// VMware runs a DHCP server on the network
+	DHCP bool
+	// VMware runs a NAT device giving the network access to the outside
+	NAT bool
+	// The host has an adapter connected to the network
+	VirtualAdapter bool
+	// Subnet of host-only and NAT networks
+	Subnet *net.IPNet
+	// Host interface of bridged networks
+	BridgeInterface string
+	// Other answers of the network, such as DHCP_CFG_HASH, by name without
+	// the VNET_N_ prefix
+	Extra map[string]string
+}
+
+// Name returns the name of the network device, such as vmnet8.
+func (n VirtualNetwork) Name() string {
+	return fmt.Sprintf("vmnet%d", n.Number)
+}
+
+// Type returns how the network connects VMs: bridged, nat, hostonly or
+// custom when none of them applies.
+func (n VirtualNetwork) Type() string {
+	switch {
+	case n.BridgeInterface != "":
+		return "bridged"
+	case n.NAT:
+		return "nat"
+	case n.Subnet != nil:
+		return "hostonly"
+	}
+	return "custom"
+}
+
+// NetworkingConfig is the networking file, /etc/vmware/networking on
+// Linux, which defines the virtual networks of the host:
+//
+//	VERSION=1,0
+//	answer VNET_8_DHCP yes
+//	answer VNET_8_HOSTONLY_NETMASK 255.255.255.0
+//	answer VNET_8_HOSTONLY_SUBNET 192.168.100.0
+//	answer VNET_8_NAT yes
+//	add_bridge_mapping eth0 0
+type NetworkingConfig struct {
+	Version  string
+	Networks []*VirtualNetwork
+	// Directives other than answers and bridge mappings, such as NAT port
+	// forwarding, kept as they were read.
+	Directives []string
+	// Lines of the file, so that they are written back in the same order
+	lines []networkingLine
+	// Answers read, as in VNET_8_NAT, so that answers set to no are
+	// written back instead of leaving VMware to apply its defaults.
+	answered map[string]bool
+}
+
+// networkingLine is a line of the networking file, with what it defines.
+type networkingLine struct {
+	raw string
+	// Name of the answer, as in VNET_8_DHCP
+	answer string
+	// Network of a bridge mapping, -1 otherwise
+	bridge    int
+	version   bool
+	directive bool
+}
+
+// ParseNetworking parses a networking file.
+func ParseNetworking(r io.Reader) (*NetworkingConfig, error) {
+	config := new(NetworkingConfig)
+	networks := make(map[int]*VirtualNetwork)
+	network := func(n int) *VirtualNetwork {
+		if networks[n] == nil {
+			networks[n] = &VirtualNetwork{Number: n}
+		}
+		return networks[n]
+	}
+
+	// Subnets are only known once both the subnet and netmask are read.
+	subnets := make(map[int][2]string)
+
+	var errors []string
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		raw := scanner.Text()
+		line := strings.TrimSpace(raw)
+		l := networkingLine{raw: raw, bridge: -1}
+		if isBlankOrComment(line) {
+			config.lines = append(config.lines, l)
+			continue
+		}
+
+		if strings.HasPrefix(line, "VERSION=") {
+			config.Version = strings.TrimPrefix(line, "VERSION=")
+			l.version = true
+			config.lines = append(config.lines, l)
+			continue
+		}
+
+		fields := strings.Fields(line)
+		switch fields[0] {
+		case "answer":
+			if len(fields) < 3 {
+				errors = append(errors, fmt.Sprintf("line %d: Invalid answer: %s", lineNum, line))
+				continue
+			}
+			m := vnetAnswerRe.FindStringSubmatch(fields[1])
+			if m == nil {
+				config.Directives = append(config.Directives, line)
+				l.directive = true
+				break
+			}
+
+			if config.answered == nil {
+				config.answered = make(map[string]bool)
+			}
+			config.answered[fields[1]] = true
+			l.answer = fields[1]
+
+			number, _ := strconv.Atoi(m[1])
+			n := network(number)
+			value := strings.Join(fields[2:], " ")
+			switch m[2] {
+			case "DHCP":
+				n.DHCP = value == "yes"
+			case "NAT":
+				n.NAT = value == "yes"
+			case "VIRTUAL_ADAPTER":
+				n.VirtualAdapter = value == "yes"
+			case "HOSTONLY_SUBNET":
+				s := subnets[number]
+				s[0] = value
+				subnets[number] = s
+			case "HOSTONLY_NETMASK":
+				s := subnets[number]
+				s[1] = value
+				subnets[number] = s
+			default:
+				if n.Extra == nil {
+					n.Extra = make(map[string]string)
+				}
+				n.Extra[m[2]] = value
+			}
+		case "add_bridge_mapping":
+			if len(fields) != 3 {
+				errors = append(errors, fmt.Sprintf("line %d: Invalid bridge mapping: %s", lineNum, line))
+				continue
+			}
+			number, err := strconv.Atoi(fields[2])
+			if err != nil {
+				errors = append(errors, fmt.Sprintf("line %d: Invalid bridge mapping: %s", lineNum, line))
+				continue
+			}
+			network(number).BridgeInterface = fields[1]
+			l.bridge = number
+		default:
+			config.Directives = append(config.Directives, line)
+			l.directive = true
+		}
+		config.lines = append(config.lines, l)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for number, s := range subnets {
+		ip, mask := net.ParseIP(s[0]).To4(), net.ParseIP(s[1]).To4()
+		if ip == nil || mask == nil {
+			errors = append(errors, fmt.Sprintf("Invalid subnet for vmnet%d: %s/%s", number, s[0], s[1]))
+			continue
+		}
+		network(number).Subnet = &net.IPNet{IP: ip.Mask(net.IPMask(mask)), Mask: net.IPMask(mask)}
+	}
+
+	if len(errors) > 0 {
+		return nil, &Error{errors}
+	}
+
+	for _, n := range networks {
+		config.Networks = append(config.Networks, n)
+	}
+	sort.Sort(byNumber(config.Networks))
+	return config, nil
+}
+
+// Sorts virtual networks by number.
+type byNumber []*VirtualNetwork
+
+func (n byNumber) Len() int           { return len(n) }
+func (n byNumber) Swap(i, j int)      { n[i], n[j] = n[j], n[i] }
+func (n byNumber) Less(i, j int) bool { return n[i].Number < n[j].Number }
+
+// Network returns the network with the given name, as in vmnet8, or nil.
+func (c *NetworkingConfig) Network(name string) *VirtualNetwork {
+	for _, n := range c.Networks {
+		if strings.EqualFold(n.Name(), name) {
+			return n
+		}
+	}
+	return nil
+}
+
+// Bytes returns the contents of the networking file. Lines are written in
+// the order they were read, with the current value of answers and bridge
+// mappings. New answers are written sorted, as VMware does, after the
+// last answer read, and new directives at the end of the file.
+func (c *NetworkingConfig) Bytes() []byte {
+	version := c.Version
+	if version == "" {
+		version = "1,0"
+	}
+
+	answers := make(map[string]string)
+	var names []string
+	bridges := make(map[int]string)
+	var numbers []int
+	for _, n := range c.Networks {
+		answer := func(name, value string) {
+			name = fmt.Sprintf("VNET_%d_%s", n.Number, name)
+			answers[name] = value
+			names = append(names, name)
+		}
+		boolean := func(name string, value bool) {
+			if value {
+				answer(name, "yes")
+			} else if c.answered[fmt.Sprintf("VNET_%d_%s", n.Number, name)] {
+				answer(name, "no")
+			}
+		}
+
+		boolean("DHCP", n.DHCP)
+		boolean("NAT", n.NAT)
+		boolean("VIRTUAL_ADAPTER", n.VirtualAdapter)
+		if n.Subnet != nil {
+			answer("HOSTONLY_SUBNET", n.Subnet.IP.String())
+			answer("HOSTONLY_NETMASK", net.IP(n.Subnet.Mask).String())
+		}
+		for name, value := range n.Extra {
+			answer(name, value)
+		}
+		if n.BridgeInterface != "" {
+			bridges[n.Number] = n.BridgeInterface
+			numbers = append(numbers, n.Number)
+		}
+	}
+	sort.Strings(names)
+	sort.Ints(numbers)
+
+	directives := make(map[string]int)
+	for _, d := range c.Directives {
+		directives[d]++
+	}
+
+	// New answers and bridge mappings go after the last ones read.
+	answersAt, bridgesAt := -1, -1
+	for i, l := range c.lines {
+		switch {
+		case l.version && answersAt < 0, l.answer != "":
+			answersAt = i
+		case l.bridge >= 0:
+			bridgesAt = i
+		}
+	}
+	if bridgesAt < answersAt {
+		bridgesAt = answersAt
+	}
+
+	var b bytes.Buffer
+	written := make(map[string]bool)
+	writeAnswers := func() {
+		for _, name := range names {
+			if !written[name] {
+				fmt.Fprintf(&b, "answer %s %s\n", name, answers[name])
+				written[name] = true
+			}
+		}
+	}
+	writeBridges := func() {
+		for _, n := range numbers {
+			if name := fmt.Sprintf("bridge%d", n); !written[name] {
+				fmt.Fprintf(&b, "add_bridge_mapping %s %d\n", bridges[n], n)
+				written[name] = true
+			}
+		}
+	}
+
+	hasVersion := false
+	for _, l := range c.lines {
+		hasVersion = hasVersion || l.version
+	}
+	if !hasVersion {
+		fmt.Fprintf(&b, "VERSION=%s\n", version)
+	}
+	if answersAt < 0 {
+		writeAnswers()
+		writeBridges()
+	}
+
+	for i, l := range c.lines {
+		switch {
+		case l.version:
+			fmt.Fprintf(&b, "VERSION=%s\n", version)
+		case l.answer != "":
+			if value, ok := answers[l.answer]; ok && !written[l.answer] {
+				fmt.Fprintf(&b, "answer %s %s\n", l.answer, value)
+				written[l.answer] = true
+			}
+		case l.bridge >= 0:
+			name := fmt.Sprintf("bridge%d", l.bridge)
+			if iface, ok := bridges[l.bridge]; ok && !written[name] {
+				fmt.Fprintf(&b, "add_bridge_mapping %s %d\n", iface, l.bridge)
+				written[name] = true
+			}
+		case l.directive:
+			// Directives removed from Directives are dropped.
+			if d := strings.TrimSpace(l.raw); directives[d] > 0 {
+				b.WriteString(l.raw + "\n")
+				directives[d]--
+			}
+		default:
+			b.WriteString(l.raw + "\n")
+		}
+
+		if i == answersAt {
+			writeAnswers()
+		}
+		if i == bridgesAt {
+			writeBridges()
+		}
+	}
+
+	for _, d := range c.Directives {
+		if directives[d] > 0 {
+			b.WriteString(d + "\n")
+			directives[d]--
+		}
+	}
+	return b.Bytes()
+}
+
+// NetworkMapping gives a name to a virtual network device.
+type NetworkMapping struct {
+	Name   string
+	Device string
+}
+
+// NetworkMap is the netmap.conf file, naming the virtual networks of the
+// host:
+//
+//	network0.name = "Bridged"
+//	network0.device = "vmnet0"
+type NetworkMap []NetworkMapping
+
+// ParseNetworkMap parses a netmap.conf file.
+func ParseNetworkMap(r io.Reader) (NetworkMap, error) {
+	doc, err := ParseDocument(r)
+	if err != nil {
+		return nil, err
+	}
+
+	re := regexp.MustCompile(`(?i)^network(\d+)\.(name|device)$`)
+	mappings := make(map[int]*NetworkMapping)
+	for _, e := range doc.uniqueEntries() {
+		m := re.FindStringSubmatch(e.Key)
+		if m == nil {
+			continue
+		}
+		n, _ := strconv.Atoi(m[1])
+		if mappings[n] == nil {
+			mappings[n] = new(NetworkMapping)
+		}
+		if strings.EqualFold(m[2], "name") {
+			mappings[n].Name = e.Value
+		} else {
+			mappings[n].Device = e.Value
+		}
+	}
+
+	numbers := make([]int, 0, len(mappings))
+	for n := range mappings {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+
+	var netmap NetworkMap
+	for _, n := range numbers {
+		netmap = append(netmap, *mappings[n])
+	}
+	return netmap, nil
+}
+
+// Device returns the device of the network named name, or an empty
+// string.
+func (m NetworkMap) Device(name string) string {
+	for _, mapping := range m {
+		if strings.EqualFold(mapping.Name, name) {
+			return mapping.Device
+		}
+	}
+	return ""
+}
+
+// Bytes returns the contents of the netmap.conf file.
+func (m NetworkMap) Bytes() []byte {
+	doc := new(Document)
+	for i, mapping := range m {
+		doc.Set(fmt.Sprintf("network%d.name", i), mapping.Name)
+		doc.Set(fmt.Sprintf("network%d.device", i), mapping.Device)
+	}
+	return doc.Bytes()
+}
+
+// ResolvedNetwork is the host network an Ethernet adapter is connected to.
+type ResolvedNetwork struct {
+	// Network device, such as vmnet8
+	Device string
+	// bridged, nat, hostonly or custom
+	Type string
+	// Definition of the network, nil if it is not defined in the
+	// networking file
+	Network *VirtualNetwork
+	// Subnet of the network, if known
+	Subnet *net.IPNet
+}
+
+// Devices VMware connects adapters to, by connection type.
+var defaultNetworkDevices = map[string]string{
+	"bridged":  "vmnet0",
+	"hostonly": "vmnet1",
+	"nat":      "vmnet8",
+}
+
+// ResolveNetwork returns the host network eth is connected to. The
+// networking configuration and network map are optional, they provide
+// the details of the network and resolve named custom networks.
+func ResolveNetwork(eth Ethernet, config *NetworkingConfig, netmap NetworkMap) (*ResolvedNetwork, error) {
+	connectionType := strings.ToLower(eth.ConnectionType)
+	if connectionType == "" {
+		connectionType = "bridged"
+	}
+
+	r := new(ResolvedNetwork)
+	switch connectionType {
+	case "bridged", "hostonly", "nat":
+		r.Device = defaultNetworkDevices[connectionType]
+		r.Type = connectionType
+	case "custom":
+		if eth.VNetwork == "" {
+			return nil, fmt.Errorf("%s uses a custom network but has no vnet", eth.VMXID)
+		}
+		r.Device = eth.VNetwork
+		if device := netmap.Device(eth.VNetwork); device != "" {
+			r.Device = device
+		}
+		// vnet may be a device path, as in /dev/vmnet2.
+		r.Device = strings.ToLower(path.Base(strings.Replace(r.Device, `\`, "/", -1)))
+		r.Type = "custom"
+	default:
+		return nil, fmt.Errorf("%s has an unsupported connection type: %s", eth.VMXID, eth.ConnectionType)
+	}
+
+	if config != nil {
+		r.Network = config.Network(r.Device)
+	}
+	if r.Network != nil {
+		r.Subnet = r.Network.Subnet
+		if r.Type == "custom" {
+			r.Type = r.Network.Type()
+		}
+	}
+	return r, nil
+}
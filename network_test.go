@@ -0,0 +1,143 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"strings"
+	"testing"
+)
+
+const testNetworking = `VERSION=1,0
+answer VNET_1_DHCP yes
+answer VNET_1_DHCP_CFG_HASH 3A1C5B5D
+answer VNET_1_HOSTONLY_NETMASK 255.255.255.0
+answer VNET_1_HOSTONLY_SUBNET 172.16.5.0
+answer VNET_1_VIRTUAL_ADAPTER yes
+answer VNET_8_DHCP yes
+answer VNET_8_HOSTONLY_NETMASK 255.255.255.0
+answer VNET_8_HOSTONLY_SUBNET 192.168.100.0
+answer VNET_8_NAT yes
+answer VNET_8_VIRTUAL_ADAPTER yes
+add_bridge_mapping eth0 0
+add_nat_portfwd 8 tcp 2222 192.168.100.10 22
+`
+
+const testNetmap = `# This file is automatically generated.
+network0.name = "Bridged"
+network0.device = "vmnet0"
+network1.name = "HostOnly"
+network1.device = "vmnet1"
+network2.name = "Lab"
+network2.device = "vmnet3"
+`
+
+func TestParseNetworking(t *testing.T) {
+	config, err := ParseNetworking(strings.NewReader(testNetworking))
+	ok(t, err)
+	equals(t, "1,0", config.Version)
+	equals(t, 3, len(config.Networks))
+
+	bridged := config.Network("vmnet0")
+	equals(t, "eth0", bridged.BridgeInterface)
+	equals(t, "bridged", bridged.Type())
+
+	hostOnly := config.Network("vmnet1")
+	equals(t, "hostonly", hostOnly.Type())
+	equals(t, "172.16.5.0/24", hostOnly.Subnet.String())
+	equals(t, "3A1C5B5D", hostOnly.Extra["DHCP_CFG_HASH"])
+
+	nat := config.Network("vmnet8")
+	equals(t, "nat", nat.Type())
+	assert(t, nat.DHCP && nat.VirtualAdapter, "vmnet8 should have DHCP and a virtual adapter")
+
+	equals(t, []string{"add_nat_portfwd 8 tcp 2222 192.168.100.10 22"}, config.Directives)
+	equals(t, testNetworking, string(config.Bytes()))
+
+	_, err = ParseNetworking(strings.NewReader("answer VNET_2_HOSTONLY_SUBNET 10.0.0.0\n"))
+	assert(t, err != nil, "expected error for a subnet without netmask")
+}
+
+func TestNetworkingBytes(t *testing.T) {
+	stock := `VERSION=1,0
+answer VNET_1_DHCP no
+answer VNET_1_HOSTONLY_NETMASK 255.255.255.0
+answer VNET_1_HOSTONLY_SUBNET 172.16.5.0
+answer VNET_1_VIRTUAL_ADAPTER yes
+add_nat_portfwd 8 tcp 2222 192.168.100.10 22
+answer VNET_8_DHCP yes
+answer VNET_8_HOSTONLY_NETMASK 255.255.255.0
+answer VNET_8_HOSTONLY_SUBNET 192.168.100.0
+answer VNET_8_NAT yes
+answer VNET_8_VIRTUAL_ADAPTER no
+add_bridge_mapping eth0 0
+`
+	config, err := ParseNetworking(strings.NewReader(stock))
+	ok(t, err)
+	equals(t, stock, string(config.Bytes()))
+
+	config.Network("vmnet8").NAT = false
+	config.Network("vmnet0").BridgeInterface = "eth1"
+	config.Networks = append(config.Networks, &VirtualNetwork{Number: 2, DHCP: true})
+	config.Directives = append(config.Directives, "add_nat_portfwd 8 udp 5353 192.168.100.10 53")
+	equals(t, `VERSION=1,0
+answer VNET_1_DHCP no
+answer VNET_1_HOSTONLY_NETMASK 255.255.255.0
+answer VNET_1_HOSTONLY_SUBNET 172.16.5.0
+answer VNET_1_VIRTUAL_ADAPTER yes
+add_nat_portfwd 8 tcp 2222 192.168.100.10 22
+answer VNET_8_DHCP yes
+answer VNET_8_HOSTONLY_NETMASK 255.255.255.0
+answer VNET_8_HOSTONLY_SUBNET 192.168.100.0
+answer VNET_8_NAT no
+answer VNET_8_VIRTUAL_ADAPTER no
+answer VNET_2_DHCP yes
+add_bridge_mapping eth1 0
+add_nat_portfwd 8 udp 5353 192.168.100.10 53
+`, string(config.Bytes()))
+
+	// Configurations built from scratch.
+	config = &NetworkingConfig{Networks: []*VirtualNetwork{{Number: 0, BridgeInterface: "eth0"}, {Number: 8, NAT: true}}}
+	equals(t, "VERSION=1,0\nanswer VNET_8_NAT yes\nadd_bridge_mapping eth0 0\n", string(config.Bytes()))
+}
+
+func TestParseNetworkMap(t *testing.T) {
+	netmap, err := ParseNetworkMap(strings.NewReader(testNetmap))
+	ok(t, err)
+	equals(t, 3, len(netmap))
+	equals(t, "vmnet3", netmap.Device("lab"))
+	equals(t, strings.SplitN(testNetmap, "\n", 2)[1], string(netmap.Bytes()))
+}
+
+func TestResolveNetwork(t *testing.T) {
+	config, err := ParseNetworking(strings.NewReader(testNetworking))
+	ok(t, err)
+	netmap, err := ParseNetworkMap(strings.NewReader(testNetmap))
+	ok(t, err)
+
+	r, err := ResolveNetwork(Ethernet{VMXID: "ethernet0", ConnectionType: "nat"}, config, netmap)
+	ok(t, err)
+	equals(t, "vmnet8", r.Device)
+	equals(t, "192.168.100.0/24", r.Subnet.String())
+	config.Networks = append(config.Networks, &VirtualNetwork{Number: 9})
+	assert(t, r.Network == config.Network("vmnet8"), "expected the network of vmnet8 to outlive appends")
+
+	r, err = ResolveNetwork(Ethernet{VMXID: "ethernet0", ConnectionType: "custom", VNetwork: "/dev/vmnet1"}, config, netmap)
+	ok(t, err)
+	equals(t, "vmnet1", r.Device)
+	equals(t, "hostonly", r.Type)
+
+	// Named networks that are not defined in the networking file.
+	r, err = ResolveNetwork(Ethernet{VMXID: "ethernet0", ConnectionType: "custom", VNetwork: "Lab"}, config, netmap)
+	ok(t, err)
+	equals(t, "vmnet3", r.Device)
+	equals(t, "custom", r.Type)
+	assert(t, r.Network == nil && r.Subnet == nil, "vmnet3 should not be defined")
+
+	r, err = ResolveNetwork(Ethernet{VMXID: "ethernet0"}, nil, nil)
+	ok(t, err)
+	equals(t, "vmnet0", r.Device)
+
+	_, err = ResolveNetwork(Ethernet{VMXID: "ethernet0", ConnectionType: "custom"}, config, netmap)
+	assert(t, err != nil, "expected error for a custom network without vnet")
+}
@@ -0,0 +1,157 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// Preferences of a user of VMware Workstation, Player or Fusion. See
+// DefaultPreferencesPath.
+type Preferences struct {
+	// Directory where new VMs are created
+	DefaultVMPath string `vmx:"prefvmx.defaultVMPath,omitempty"`
+	// Memory, in MB, all running VMs can use
+	AllVMMemoryLimit uint `vmx:"prefvmx.allVMMemoryLimit,omitempty"`
+	// Percentage of the memory of VMs that must fit in host memory
+	MinVMMemPct uint `vmx:"prefvmx.minVmMemPct,omitempty"`
+	// Hide every hint dialog
+	HideHints bool `vmx:"hints.hideAll,omitempty"`
+	// allow or deny
+	AutoSoftwareUpdatePermission string `vmx:"pref.autoSoftwareUpdatePermission,omitempty"`
+	// TRUE or FALSE. Preferences VMware enables by default are strings,
+	// since a false bool would be omitted and VMware would enable them.
+	DataCollectionEnabled string            `vmx:"pref.dataCollectionEnabled,omitempty"`
+	TrayIconEnabled       string            `vmx:"pref.trayicon.enabled,omitempty"`
+	LastUpdateCheckSec    string            `vmx:"pref.lastUpdateCheckSec,omitempty"`
+	Player                PlayerPreferences `vmx:"pref.vmplayer,omitempty"`
+}
+
+// PlayerPreferences are the pref.vmplayer.* preferences. WebUpdateOnStartup
+// and DataCollectionEnabled are TRUE or FALSE, see Preferences.
+type PlayerPreferences struct {
+	// What to do with running VMs on exit: poweroff or suspend
+	ExitVMAction          string `vmx:"exit.vmAction,omitempty"`
+	FullScreenAutoHide    bool   `vmx:"fullscreen.autohide,omitempty"`
+	WebUpdateOnStartup    string `vmx:"webUpdateOnStartup,omitempty"`
+	DataCollectionEnabled string `vmx:"dataCollectionEnabled,omitempty"`
+}
+
+// HostConfig is the system wide configuration of a VMware installation.
+// See DefaultHostConfigPath.
+type HostConfig struct {
+	LibDir         string `vmx:"libdir,omitempty"`
+	BinDir         string `vmx:"bindir,omitempty"`
+	VixLibDir      string `vmx:"vix.libdir,omitempty"`
+	VMwareFullPath string `vmx:"vmware.fullpath,omitempty"`
+	AuthdFullPath  string `vmx:"authd.fullpath,omitempty"`
+	// Whether host networking is configured: yes or no
+	Networking           string            `vmx:"NETWORKING,omitempty"`
+	ProductName          string            `vmx:"product.name,omitempty"`
+	ProductVersion       string            `vmx:"product.version,omitempty"`
+	ProductBuildNumber   string            `vmx:"product.buildNumber,omitempty"`
+	PlayerProductVersion string            `vmx:"player.product.version,omitempty"`
+	WorkstationVersion   string            `vmx:"workstation.product.version,omitempty"`
+	InstallerDefaults    InstallerDefaults `vmx:"installerDefaults,omitempty"`
+}
+
+// InstallerDefaults are the installerDefaults.* settings, applied to the
+// preferences of new users. Values are yes or no.
+type InstallerDefaults struct {
+	AutoSoftwareUpdateEnabled string `vmx:"autoSoftwareUpdateEnabled,omitempty"`
+	ComponentDownloadEnabled  string `vmx:"componentDownloadEnabled,omitempty"`
+	DataCollectionEnabled     string `vmx:"dataCollectionEnabled,omitempty"`
+}
+
+// DefaultPreferencesPath returns where VMware products keep the
+// preferences of the current user.
+func DefaultPreferencesPath() (string, error) {
+	return preferencesPath(runtime.GOOS, os.Getenv)
+}
+
+// DefaultHostConfigPath returns where VMware products keep their system
+// wide configuration.
+func DefaultHostConfigPath() (string, error) {
+	return hostConfigPath(runtime.GOOS, os.Getenv)
+}
+
+// DefaultLibraryPath returns where VMware Workstation keeps the library of
+// the current user, or Fusion its list of VMs. See Library.
+func DefaultLibraryPath() (string, error) {
+	return libraryPath(runtime.GOOS, os.Getenv)
+}
+
+// Returns the directory in the environment variable key, failing if it is
+// not set rather than returning a path relative to the root.
+func envDir(getenv func(string) string, key string) (string, error) {
+	dir := getenv(key)
+	if dir == "" {
+		return "", fmt.Errorf("%s is not set", key)
+	}
+	return dir, nil
+}
+
+// Returns the home directory of the current user.
+func homeDir(goos string, getenv func(string) string) (string, error) {
+	if goos == "windows" {
+		return envDir(getenv, "USERPROFILE")
+	}
+	return envDir(getenv, "HOME")
+}
+
+func preferencesPath(goos string, getenv func(string) string) (string, error) {
+	if goos == "windows" {
+		dir, err := envDir(getenv, "APPDATA")
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, "VMware", "preferences.ini"), nil
+	}
+
+	home, err := homeDir(goos, getenv)
+	if err != nil {
+		return "", err
+	}
+	if goos == "darwin" {
+		return filepath.Join(home, "Library", "Preferences", "VMware Fusion", "preferences"), nil
+	}
+	return filepath.Join(home, ".vmware", "preferences"), nil
+}
+
+func hostConfigPath(goos string, getenv func(string) string) (string, error) {
+	switch goos {
+	case "windows":
+		dir, err := envDir(getenv, "ProgramData")
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, "VMware", "VMware Workstation", "config.ini"), nil
+	case "darwin":
+		return "/Library/Preferences/VMware Fusion/config", nil
+	default:
+		return "/etc/vmware/config", nil
+	}
+}
+
+func libraryPath(goos string, getenv func(string) string) (string, error) {
+	if goos == "windows" {
+		dir, err := envDir(getenv, "APPDATA")
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, "VMware", "inventory.vmls"), nil
+	}
+
+	home, err := homeDir(goos, getenv)
+	if err != nil {
+		return "", err
+	}
+	if goos == "darwin" {
+		return filepath.Join(home, "Library", "Application Support", "VMware Fusion", "vmInventory"), nil
+	}
+	return filepath.Join(home, ".vmware", "inventory.vmls"), nil
+}
@@ -0,0 +1,100 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPreferences(t *testing.T) {
+	doc, err := ParseDocument(strings.NewReader(`.encoding = "UTF-8"
+prefvmx.defaultVMPath = "/home/me/vmware"
+pref.vmplayer.exit.vmAction = "suspend"
+# Shown once
+hints.hideAll = "TRUE"
+pref.trayicon.enabled = "TRUE"
+pref.ws.session.window.count = "1"
+`))
+	ok(t, err)
+
+	prefs := new(Preferences)
+	ok(t, doc.Decode(prefs))
+	equals(t, "/home/me/vmware", prefs.DefaultVMPath)
+	equals(t, "suspend", prefs.Player.ExitVMAction)
+	equals(t, true, prefs.HideHints)
+
+	prefs.DefaultVMPath = "/srv/vms"
+	prefs.Player.ExitVMAction = ""
+	prefs.HideHints = false
+	prefs.Player.FullScreenAutoHide = true
+	prefs.AllVMMemoryLimit = 4096
+	// Preferences enabled by default can be turned off.
+	prefs.TrayIconEnabled = "FALSE"
+	prefs.Player.WebUpdateOnStartup = "FALSE"
+	ok(t, doc.Update(prefs))
+
+	equals(t, `.encoding = "UTF-8"
+prefvmx.defaultVMPath = "/srv/vms"
+# Shown once
+pref.trayicon.enabled = "FALSE"
+pref.ws.session.window.count = "1"
+prefvmx.allVMMemoryLimit = "4096"
+pref.vmplayer.fullscreen.autohide = "TRUE"
+pref.vmplayer.webUpdateOnStartup = "FALSE"
+`, doc.String())
+}
+
+func TestUpdateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govmx")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "vmware", "config")
+	config := new(HostConfig)
+	ok(t, UpdateFile(path, config, func() error {
+		config.InstallerDefaults.AutoSoftwareUpdateEnabled = "no"
+		return nil
+	}, nil))
+
+	ok(t, UpdateFile(path, config, func() error {
+		config.Networking = "yes"
+		return nil
+	}, nil))
+
+	data, err := ioutil.ReadFile(path)
+	ok(t, err)
+	equals(t, "installerDefaults.autoSoftwareUpdateEnabled = \"no\"\nNETWORKING = \"yes\"\n", string(data))
+}
+
+func TestDefaultPaths(t *testing.T) {
+	env := map[string]string{
+		"HOME":        "/home/me",
+		"APPDATA":     `C:\Users\me\AppData\Roaming`,
+		"ProgramData": `C:\ProgramData`,
+	}
+	getenv := func(key string) string {
+		return env[key]
+	}
+	path := func(p string, err error) string {
+		ok(t, err)
+		return p
+	}
+
+	equals(t, filepath.Join("/home/me", ".vmware", "preferences"), path(preferencesPath("linux", getenv)))
+	equals(t, filepath.Join("/home/me", "Library", "Preferences", "VMware Fusion", "preferences"), path(preferencesPath("darwin", getenv)))
+	equals(t, filepath.Join(`C:\Users\me\AppData\Roaming`, "VMware", "preferences.ini"), path(preferencesPath("windows", getenv)))
+	equals(t, "/etc/vmware/config", path(hostConfigPath("linux", getenv)))
+	equals(t, filepath.Join("/home/me", ".vmware", "inventory.vmls"), path(libraryPath("linux", getenv)))
+
+	// Paths are not made relative to the root when HOME is not set.
+	delete(env, "HOME")
+	_, err := preferencesPath("linux", getenv)
+	assert(t, err != nil, "expected error without HOME")
+	_, err = libraryPath("darwin", getenv)
+	assert(t, err != nil, "expected error without HOME")
+}
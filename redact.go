@@ -0,0 +1,67 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// Keys redacted by Redact, as lowercased path.Match patterns.
+var secretKeyPatterns = []string{
+	"remotedisplay.vnc.password",
+	"remotedisplay.vnc.key",
+	"guestinfo.*",
+	"encryption.keysafe",
+	"encryption.data",
+	"*.password",
+}
+
+// Redact returns a copy of doc with the values of secret keys replaced by
+// RedactedValue. Besides the built-in patterns, which cover VNC passwords,
+// guestinfo variables and encryption keys, more keys can be given as
+// path.Match patterns, such as "ethernet*.address".
+func Redact(doc *Document, patterns ...string) *Document {
+	redacted := doc.Copy()
+	for i := range redacted.lines {
+		l := &redacted.lines[i]
+		if l.isEntry && l.Value != "" && isSecretKey(l.Key, patterns) {
+			l.Value = RedactedValue
+			l.dirty = true
+		}
+	}
+	return redacted
+}
+
+func isSecretKey(key string, patterns []string) bool {
+	key = strings.ToLower(key)
+	for _, list := range [][]string{secretKeyPatterns, patterns} {
+		for _, pattern := range list {
+			if matched, _ := path.Match(strings.ToLower(pattern), key); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// String returns vm in VMX format with secrets redacted.
+func (vm VirtualMachine) String() string {
+	var b bytes.Buffer
+	e := NewEncoder(&b)
+	e.Redact = true
+	if err := e.Encode(vm); err != nil {
+		return fmt.Sprintf("%%!(vmx error: %v)", err)
+	}
+	return b.String()
+}
+
+// Format implements fmt.Formatter so that no verb, %#v included, prints
+// secrets. It always writes the output of String.
+func (vm VirtualMachine) Format(f fmt.State, verb rune) {
+	io.WriteString(f, vm.String())
+}
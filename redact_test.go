@@ -0,0 +1,54 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	doc, err := ParseDocument(strings.NewReader(`displayName = "core01"
+RemoteDisplay.vnc.password = "hunter2"
+remotedisplay.vnc.key = "c2VjcmV0"
+guestinfo.userdata = "I2Nsb3VkLWNvbmZpZwo="
+encryption.keySafe = "vmware:key/list/()"
+ethernet0.address = "00:50:56:aa:bb:cc"
+RemoteDisplay.vnc.port = "5900"
+`))
+	ok(t, err)
+
+	redacted := Redact(doc, "ethernet*.address")
+	equals(t, `displayName = "core01"
+RemoteDisplay.vnc.password = "[REDACTED]"
+remotedisplay.vnc.key = "[REDACTED]"
+guestinfo.userdata = "[REDACTED]"
+encryption.keySafe = "[REDACTED]"
+ethernet0.address = "[REDACTED]"
+RemoteDisplay.vnc.port = "5900"
+`, redacted.String())
+
+	// The original document is left untouched.
+	value, _ := doc.Get("RemoteDisplay.vnc.password")
+	equals(t, "hunter2", value)
+}
+
+func TestMarshalRedacted(t *testing.T) {
+	vm := new(VirtualMachine)
+	vm.DisplayName = "core01"
+	vm.RemoteDisplay.VNCEnabled = true
+	vm.RemoteDisplay.VNCPassword = "hunter2"
+
+	data, err := Marshal(vm)
+	ok(t, err)
+	assert(t, strings.Contains(string(data), `remotedisplay.vnc.password = "hunter2"`), "Marshal should not redact:\n%s", data)
+
+	for _, format := range []string{"%s", "%v", "%+v", "%#v"} {
+		out := fmt.Sprintf(format, vm)
+		assert(t, !strings.Contains(out, "hunter2"), "%s printed the secret:\n%s", format, out)
+		assert(t, strings.Contains(out, `remotedisplay.vnc.password = "[REDACTED]"`), "%s did not redact:\n%s", format, out)
+		assert(t, strings.Contains(out, `displayname = "core01"`), "%s unexpected output:\n%s", format, out)
+	}
+}
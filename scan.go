@@ -0,0 +1,396 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Inventory lists the VMs and disks found by Scan.
+type Inventory struct {
+	Root string
+	VMs  []VMInfo
+	// Disks not used by any VM, directly or as the parent of another disk
+	OrphanedDisks []string
+	// References to files that do not exist
+	BrokenReferences []BrokenReference
+	// Errors reading the directory tree. Directories that can not be
+	// read are skipped.
+	Errors []error
+	// On-disk size of the files of every VM and orphaned disk, in bytes.
+	// Files shared between VMs, such as the base disk of linked clones,
+	// are counted once.
+	Size int64
+}
+
+// VMInfo describes a VM found by Scan.
+type VMInfo struct {
+	Path string
+	VM   *VirtualMachine
+	// Error reading or decoding the VMX file. VM may still be partially
+	// decoded, as with encrypted VMs.
+	Err   error
+	Disks []DiskInfo
+	// On-disk size of the VMX file and its disks, in bytes
+	Size int64
+}
+
+// DiskInfo is a virtual disk attached to a VM.
+type DiskInfo struct {
+	// Device the disk is attached to, e.g. scsi0:0
+	Device string
+	Path   string
+	// Nil if the descriptor could not be read
+	Descriptor *DiskDescriptor
+	// Files holding the disk, including extents and parent disks
+	Files []string
+	// On-disk size of Files, in bytes
+	Size int64
+}
+
+// BrokenReference is a reference to a file that does not exist.
+type BrokenReference struct {
+	// File holding the reference, a VMX file or a disk descriptor
+	Source string
+	// Key holding the reference, such as scsi0:0.fileName, or
+	// parentFileNameHint or extent for disk descriptors
+	Key    string
+	Target string
+}
+
+// ScanOptions customizes Scan.
+type ScanOptions struct {
+	// Number of files parsed concurrently. Defaults to the number of CPUs.
+	Workers int
+}
+
+// Scan walks the directory tree at root and returns an inventory of the
+// VMs and disks found in it.
+func Scan(root string, opts *ScanOptions) (*Inventory, error) {
+	workers := runtime.NumCPU()
+	if opts != nil && opts.Workers > 0 {
+		workers = opts.Workers
+	}
+
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var vmxPaths, vmdkPaths []string
+	var walkErrors []error
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			walkErrors = append(walkErrors, err)
+			if info != nil && info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".vmx":
+			vmxPaths = append(vmxPaths, path)
+		case ".vmdk":
+			vmdkPaths = append(vmdkPaths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &scanner{
+		descriptors: make(map[string]*DiskDescriptor),
+		errors:      make(map[string]error),
+		sizes:       make(map[string]int64),
+		reported:    make(map[BrokenReference]bool),
+	}
+
+	// Descriptors are read upfront so that the extents of every disk are
+	// known when looking for orphans.
+	parallel(workers, len(vmdkPaths), func(i int) {
+		s.descriptor(vmdkPaths[i])
+	})
+
+	inv := &Inventory{Root: root, VMs: make([]VMInfo, len(vmxPaths)), Errors: walkErrors}
+	parallel(workers, len(vmxPaths), func(i int) {
+		inv.VMs[i] = s.scanVM(vmxPaths[i])
+	})
+
+	used := make(map[string]bool)
+	for _, vm := range inv.VMs {
+		for _, d := range vm.Disks {
+			for _, f := range d.Files {
+				used[f] = true
+			}
+		}
+	}
+
+	// Extent files belong to their descriptor, so that an unused disk is
+	// reported once and not along with every file holding its data.
+	extents := make(map[string]bool)
+	for _, path := range vmdkPaths {
+		if d := s.descriptors[path]; d != nil {
+			for _, f := range extentFiles(path, d) {
+				if f != path {
+					extents[f] = true
+				}
+			}
+		}
+	}
+
+	files := make(map[string]bool)
+	for _, path := range vmdkPaths {
+		if used[path] || extents[path] {
+			continue
+		}
+		inv.OrphanedDisks = append(inv.OrphanedDisks, path)
+		files[path] = true
+		if d := s.descriptors[path]; d != nil {
+			for _, f := range extentFiles(path, d) {
+				files[f] = true
+			}
+		}
+	}
+
+	for _, vm := range inv.VMs {
+		files[vm.Path] = true
+		for _, d := range vm.Disks {
+			for _, f := range d.Files {
+				files[f] = true
+			}
+		}
+	}
+	for f := range files {
+		inv.Size += s.size(f)
+	}
+
+	inv.BrokenReferences = s.broken
+	sort.Sort(bySource(inv.BrokenReferences))
+	sort.Strings(inv.OrphanedDisks)
+	return inv, nil
+}
+
+// Runs f for every index in [0, n) using at most workers goroutines.
+func parallel(workers, n int, f func(i int)) {
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				f(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+// State shared by the workers of Scan.
+type scanner struct {
+	mu          sync.Mutex
+	descriptors map[string]*DiskDescriptor
+	errors      map[string]error
+	sizes       map[string]int64
+	broken      []BrokenReference
+	reported    map[BrokenReference]bool
+}
+
+// Returns the descriptor of the disk at path, reading it only once.
+func (s *scanner) descriptor(path string) (*DiskDescriptor, error) {
+	s.mu.Lock()
+	d, found := s.descriptors[path]
+	err := s.errors[path]
+	s.mu.Unlock()
+	if found {
+		return d, err
+	}
+
+	d, err = ReadDiskDescriptor(path)
+	s.mu.Lock()
+	s.descriptors[path] = d
+	s.errors[path] = err
+	s.mu.Unlock()
+	return d, err
+}
+
+// Returns the size of the file at path, or 0 if it does not exist.
+func (s *scanner) size(path string) int64 {
+	s.mu.Lock()
+	size, found := s.sizes[path]
+	s.mu.Unlock()
+	if found {
+		return size
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		size = info.Size()
+	}
+	s.mu.Lock()
+	s.sizes[path] = size
+	s.mu.Unlock()
+	return size
+}
+
+// Adds a broken reference, once. Disks shared by several VMs, such as the
+// base disk of linked clones, are walked for each of them.
+func (s *scanner) addBroken(ref BrokenReference) {
+	s.mu.Lock()
+	if !s.reported[ref] {
+		s.reported[ref] = true
+		s.broken = append(s.broken, ref)
+	}
+	s.mu.Unlock()
+}
+
+func (s *scanner) scanVM(path string) VMInfo {
+	info := VMInfo{Path: path, VM: new(VirtualMachine)}
+
+	data, _, err := readFile(path)
+	if err != nil {
+		info.Err = err
+		return info
+	}
+	info.Err = Unmarshal(data, info.VM)
+
+	doc, err := ParseDocument(bytes.NewReader(data))
+	if err != nil {
+		if info.Err == nil {
+			info.Err = err
+		}
+		return info
+	}
+
+	info.Size = s.size(path)
+	for _, ref := range diskReferences(doc) {
+		disk := DiskInfo{Device: ref.device, Path: resolvePath(filepath.Dir(path), ref.fileName)}
+		if _, err := os.Stat(disk.Path); err != nil {
+			s.addBroken(BrokenReference{Source: path, Key: ref.key, Target: disk.Path})
+		} else {
+			disk.Files = s.diskFiles(disk.Path)
+			disk.Descriptor, _ = s.descriptor(disk.Path)
+		}
+
+		for _, f := range disk.Files {
+			disk.Size += s.size(f)
+		}
+		info.Size += disk.Size
+		info.Disks = append(info.Disks, disk)
+	}
+	return info
+}
+
+type diskReference struct {
+	device   string
+	key      string
+	fileName string
+}
+
+// Returns the disks attached to present devices, in the order they
+// appear in doc.
+func diskReferences(doc *Document) []diskReference {
+	var refs []diskReference
+	for _, e := range doc.uniqueEntries() {
+		device := DeviceOf(e.Key)
+		if device == "" || !strings.EqualFold(e.Key[len(device):], ".fileName") {
+			continue
+		}
+		if !strings.EqualFold(filepath.Ext(e.Value), ".vmdk") {
+			continue
+		}
+		if present, _ := doc.Get(device + ".present"); strings.EqualFold(present, "false") {
+			continue
+		}
+		refs = append(refs, diskReference{device: device, key: e.Key, fileName: e.Value})
+	}
+	return refs
+}
+
+// Returns the files holding the disk at path: its descriptor, extents and
+// the files of its parent disks. Missing files are reported as broken.
+func (s *scanner) diskFiles(path string) []string {
+	var files []string
+	seen := make(map[string]bool)
+	for path != "" && !seen[path] {
+		seen[path] = true
+		files = append(files, path)
+
+		d, err := s.descriptor(path)
+		if err != nil {
+			break
+		}
+
+		for _, f := range extentFiles(path, d) {
+			if f == path {
+				continue
+			}
+			if _, err := os.Stat(f); err != nil {
+				s.addBroken(BrokenReference{Source: path, Key: "extent", Target: f})
+				continue
+			}
+			files = append(files, f)
+		}
+
+		if d.ParentFileNameHint == "" {
+			break
+		}
+		parent := resolvePath(filepath.Dir(path), d.ParentFileNameHint)
+		if _, err := os.Stat(parent); err != nil {
+			s.addBroken(BrokenReference{Source: path, Key: "parentFileNameHint", Target: parent})
+			break
+		}
+		path = parent
+	}
+	return files
+}
+
+// Returns the paths of the extent files of the disk at path.
+func extentFiles(path string, d *DiskDescriptor) []string {
+	var files []string
+	for _, e := range d.Extents {
+		if e.Filename != "" {
+			files = append(files, resolvePath(filepath.Dir(path), e.Filename))
+		}
+	}
+	return files
+}
+
+// Resolves paths relative to dir. Absolute paths are returned as they are.
+func resolvePath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(dir, path)
+}
+
+// Sorts broken references by source file and key.
+type bySource []BrokenReference
+
+func (r bySource) Len() int      { return len(r) }
+func (r bySource) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r bySource) Less(i, j int) bool {
+	if r[i].Source != r[j].Source {
+		return r[i].Source < r[j].Source
+	}
+	return r[i].Key < r[j].Key
+}
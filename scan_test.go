@@ -0,0 +1,100 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScan(t *testing.T) {
+	root, err := ioutil.TempDir("", "govmx")
+	ok(t, err)
+	defer os.RemoveAll(root)
+	root, err = filepath.EvalSymlinks(root)
+	ok(t, err)
+
+	write := func(name, contents string) string {
+		path := filepath.Join(root, name)
+		ok(t, os.MkdirAll(filepath.Dir(path), 0755))
+		ok(t, ioutil.WriteFile(path, []byte(contents), 0644))
+		return path
+	}
+
+	vmx1 := write("vm1/vm1.vmx", `displayName = "vm1"
+scsi0:0.present = "TRUE"
+scsi0:0.fileName = "vm1.vmdk"
+scsi0:1.present = "TRUE"
+scsi0:1.fileName = "missing.vmdk"
+scsi0:2.present = "FALSE"
+scsi0:2.fileName = "removed.vmdk"
+ide1:0.fileName = "cdrom.iso"
+`)
+	vm1Disk := write("vm1/vm1.vmdk", "# Disk DescriptorFile\nparentFileNameHint=\"../base/base.vmdk\"\nRW 8 FLAT \"vm1-flat.vmdk\" 0\n")
+	vm1Flat := write("vm1/vm1-flat.vmdk", "0123456789")
+	base := write("base/base.vmdk", "# Disk DescriptorFile\nRW 8 FLAT \"base-flat.vmdk\" 0\nRW 8 FLAT \"base-gone.vmdk\" 0\n")
+	baseFlat := write("base/base-flat.vmdk", "01234567890123456789")
+
+	vmx2 := write("vm2/vm2.vmx", "displayName = \"vm2\"\nsata0:0.fileName = \"vm2.vmdk\"\n")
+	vm2Disk := filepath.Join(root, "vm2/vm2.vmdk")
+	writeSparseDisk(t, vm2Disk, "# Disk DescriptorFile\nRW 2048 SPARSE \"vm2.vmdk\"\n")
+
+	// Linked clone of the same base disk.
+	vmx3 := write("vm3/vm3.vmx", "displayName = \"vm3\"\nscsi0:0.fileName = \"vm3.vmdk\"\n")
+	write("vm3/vm3.vmdk", "# Disk DescriptorFile\nparentFileNameHint=\"../base/base.vmdk\"\nRW 8 FLAT \"vm3-flat.vmdk\" 0\n")
+	write("vm3/vm3-flat.vmdk", "01234")
+
+	old := write("old/old.vmdk", "# Disk DescriptorFile\nRW 8 FLAT \"old-flat.vmdk\" 0\n")
+	write("old/old-flat.vmdk", "0123")
+	lost := write("old/lost-flat.vmdk", "01")
+
+	inv, err := Scan(root, &ScanOptions{Workers: 2})
+	ok(t, err)
+	equals(t, 3, len(inv.VMs))
+	equals(t, 0, len(inv.Errors))
+
+	vm1 := inv.VMs[0]
+	equals(t, vmx1, vm1.Path)
+	ok(t, vm1.Err)
+	equals(t, "vm1", vm1.VM.DisplayName)
+	equals(t, 2, len(vm1.Disks))
+	equals(t, "scsi0:0", vm1.Disks[0].Device)
+	equals(t, []string{vm1Disk, vm1Flat, base, baseFlat}, vm1.Disks[0].Files)
+	equals(t, int64(10+20)+int64(len("# Disk DescriptorFile\nparentFileNameHint=\"../base/base.vmdk\"\nRW 8 FLAT \"vm1-flat.vmdk\" 0\n")+len("# Disk DescriptorFile\nRW 8 FLAT \"base-flat.vmdk\" 0\nRW 8 FLAT \"base-gone.vmdk\" 0\n")), vm1.Disks[0].Size)
+
+	vm2 := inv.VMs[1]
+	equals(t, vmx2, vm2.Path)
+	equals(t, []string{vm2Disk}, vm2.Disks[0].Files)
+	equals(t, int64(1024), vm2.Disks[0].Size)
+	equals(t, vmx3, inv.VMs[2].Path)
+
+	equals(t, []string{lost, old}, inv.OrphanedDisks)
+	equals(t, []BrokenReference{
+		{Source: base, Key: "extent", Target: filepath.Join(root, "base/base-gone.vmdk")},
+		{Source: vmx1, Key: "scsi0:1.fileName", Target: filepath.Join(root, "vm1/missing.vmdk")},
+	}, inv.BrokenReferences)
+
+	var size int64
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	equals(t, size, inv.Size)
+
+	// Directories that can not be read are reported and skipped.
+	locked := filepath.Join(root, "locked")
+	ok(t, os.Mkdir(locked, 0))
+	defer os.Chmod(locked, 0755)
+	if _, err := ioutil.ReadDir(locked); err == nil {
+		t.Skip("permissions are not enforced for this user")
+	}
+	inv, err = Scan(root, nil)
+	ok(t, err)
+	equals(t, 3, len(inv.VMs))
+	equals(t, 1, len(inv.Errors))
+}
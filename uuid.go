@@ -0,0 +1,108 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// VMwareUUID is a UUID as VMware writes uuid.bios and uuid.location: its
+// 16 bytes in hexadecimal, separated by spaces and a dash halfway, as in
+// 56 4d 1a 2b 3c 4d 5e 6f-7a 8b 9c 0d 1e 2f 3a 4b
+//
+// The zero value means the UUID is not set.
+type VMwareUUID [16]byte
+
+// NewVMwareUUID returns a random UUID. Like the UUIDs VMware generates,
+// it starts with 56 4d.
+func NewVMwareUUID() VMwareUUID {
+	var u VMwareUUID
+	rand.Read(u[:])
+	u[0], u[1] = 0x56, 0x4d
+	return u
+}
+
+// ParseVMwareUUID parses a UUID in the VMware format or as defined by RFC
+// 4122, as in 564d1a2b-3c4d-5e6f-7a8b-9c0d1e2f3a4b.
+func ParseVMwareUUID(s string) (VMwareUUID, error) {
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(s))
+	digits = strings.TrimSuffix(strings.TrimPrefix(digits, "{"), "}")
+
+	var u VMwareUUID
+	if len(digits) != 32 {
+		return u, fmt.Errorf("Invalid UUID: %s", s)
+	}
+	if _, err := hex.Decode(u[:], []byte(digits)); err != nil {
+		return u, fmt.Errorf("Invalid UUID: %s", s)
+	}
+	return u, nil
+}
+
+// VMwareUUIDFromSMBIOS returns the UUID stored in b the way SMBIOS stores
+// it, with its first three fields in little endian order. This is what
+// guests read from the system information table.
+func VMwareUUIDFromSMBIOS(b [16]byte) VMwareUUID {
+	return VMwareUUID(swapUUIDFields(b))
+}
+
+// IsZero reports whether the UUID is not set.
+func (u VMwareUUID) IsZero() bool {
+	return u == VMwareUUID{}
+}
+
+func (u VMwareUUID) String() string {
+	var b bytes.Buffer
+	for i, c := range u {
+		switch {
+		case i == 8:
+			b.WriteByte('-')
+		case i > 0:
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "%02x", c)
+	}
+	return b.String()
+}
+
+// RFC4122 returns the UUID in the format defined by RFC 4122, as shown by
+// vSphere.
+func (u VMwareUUID) RFC4122() string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// SMBIOS returns the UUID in the byte order SMBIOS stores it, with its
+// first three fields in little endian order.
+func (u VMwareUUID) SMBIOS() [16]byte {
+	return swapUUIDFields(u)
+}
+
+func swapUUIDFields(b [16]byte) [16]byte {
+	b[0], b[1], b[2], b[3] = b[3], b[2], b[1], b[0]
+	b[4], b[5] = b[5], b[4]
+	b[6], b[7] = b[7], b[6]
+	return b
+}
+
+// MarshalVMX implements Marshaler. The zero UUID is encoded as an empty
+// value.
+func (u VMwareUUID) MarshalVMX() (string, error) {
+	if u.IsZero() {
+		return "", nil
+	}
+	return u.String(), nil
+}
+
+// UnmarshalVMX implements Unmarshaler.
+func (u *VMwareUUID) UnmarshalVMX(value string) error {
+	parsed, err := ParseVMwareUUID(value)
+	if err != nil {
+		return err
+	}
+	*u = parsed
+	return nil
+}
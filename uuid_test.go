@@ -0,0 +1,68 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseVMwareUUID(t *testing.T) {
+	want := VMwareUUID{0x56, 0x4d, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e, 0x6f, 0x7a, 0x8b, 0x9c, 0x0d, 0x1e, 0x2f, 0x3a, 0x4b}
+	for _, s := range []string{
+		"56 4d 1a 2b 3c 4d 5e 6f-7a 8b 9c 0d 1e 2f 3a 4b",
+		"564d1a2b-3c4d-5e6f-7a8b-9c0d1e2f3a4b",
+		"{564D1A2B-3C4D-5E6F-7A8B-9C0D1E2F3A4B}",
+	} {
+		u, err := ParseVMwareUUID(s)
+		ok(t, err)
+		equals(t, want, u)
+	}
+
+	equals(t, "56 4d 1a 2b 3c 4d 5e 6f-7a 8b 9c 0d 1e 2f 3a 4b", want.String())
+	equals(t, "564d1a2b-3c4d-5e6f-7a8b-9c0d1e2f3a4b", want.RFC4122())
+
+	for _, s := range []string{"", "56 4d 1a", "zz 4d 1a 2b 3c 4d 5e 6f-7a 8b 9c 0d 1e 2f 3a 4b"} {
+		_, err := ParseVMwareUUID(s)
+		assert(t, err != nil, "expected error parsing %q", s)
+	}
+}
+
+func TestVMwareUUIDSMBIOS(t *testing.T) {
+	u, err := ParseVMwareUUID("56 4d 1a 2b 3c 4d 5e 6f-7a 8b 9c 0d 1e 2f 3a 4b")
+	ok(t, err)
+
+	smbios := u.SMBIOS()
+	equals(t, [16]byte{0x2b, 0x1a, 0x4d, 0x56, 0x4d, 0x3c, 0x6f, 0x5e, 0x7a, 0x8b, 0x9c, 0x0d, 0x1e, 0x2f, 0x3a, 0x4b}, smbios)
+	equals(t, u, VMwareUUIDFromSMBIOS(smbios))
+}
+
+func TestNewVMwareUUID(t *testing.T) {
+	a, b := NewVMwareUUID(), NewVMwareUUID()
+	assert(t, a != b, "expected different UUIDs")
+	assert(t, !a.IsZero(), "expected a non zero UUID")
+	equals(t, "56 4d", a.String()[:5])
+}
+
+func TestVMwareUUIDMarshaling(t *testing.T) {
+	vm := new(VirtualMachine)
+	err := Unmarshal([]byte(`uuid.bios = "56 4d 59 1a 1a 9b 5f d8-29 6c 70 d0 bf 20 41 99"
+uuid.location = "56 4d 59 1a 1a 9b 5f d8-29 6c 70 d0 bf 20 41 9a"
+`), vm)
+	ok(t, err)
+	equals(t, "564d591a-1a9b-5fd8-296c-70d0bf204199", vm.UUID.Bios.RFC4122())
+	equals(t, byte(0x9a), vm.UUID.Location[15])
+
+	data, err := Marshal(vm)
+	ok(t, err)
+	assert(t, strings.Contains(string(data), `uuid.bios = "56 4d 59 1a 1a 9b 5f d8-29 6c 70 d0 bf 20 41 99"`), "expected uuid.bios in:\n%s", data)
+
+	// Unset UUIDs are omitted.
+	data, err = Marshal(&VirtualMachine{DisplayName: "core01"})
+	ok(t, err)
+	assert(t, !strings.Contains(string(data), "uuid."), "expected no UUID in:\n%s", data)
+
+	err = Unmarshal([]byte(`uuid.bios = "56 4d"`+"\n"), new(VirtualMachine))
+	assert(t, err != nil, "expected error decoding an invalid UUID")
+}
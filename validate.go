@@ -0,0 +1,107 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Minimum virtual hardware versions of firmware features.
+const (
+	minHardwareEFI        = 8
+	minHardwareSecureBoot = 13
+	minHardwareVTPM       = 14
+	minHardwareVBS        = 14
+)
+
+// Devices bios.bootOrder accepts.
+var bootDeviceRe = regexp.MustCompile(`^(hdd|cdrom|floppy|ethernet\d+)$`)
+
+// BootDevices returns the devices of the boot order, lowercased.
+func (b BIOS) BootDevices() []string {
+	var devices []string
+	for _, d := range strings.Split(b.BootOrder, ",") {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			devices = append(devices, d)
+		}
+	}
+	return devices
+}
+
+// SetBootDevices sets the boot order to devices, such as hdd, cdrom,
+// floppy or ethernet0.
+func (b *BIOS) SetBootDevices(devices ...string) {
+	b.BootOrder = strings.Join(devices, ",")
+}
+
+// Validate checks that vm only uses settings supported by its virtual
+// hardware version and that they are consistent with each other, as
+// VMware refuses to power on VMs otherwise. The virtual hardware version
+// is only checked if set.
+func (vm VirtualMachine) Validate() error {
+	var errors []string
+	hw := vm.Vhardware.Version
+
+	firmware := strings.ToLower(vm.Firmware)
+	switch firmware {
+	case "", FIRMWARE_BIOS:
+	case FIRMWARE_EFI:
+		if hw != 0 && hw < minHardwareEFI {
+			errors = append(errors, fmt.Sprintf("EFI firmware requires virtual hardware version %d or later, found %d", minHardwareEFI, hw))
+		}
+	default:
+		errors = append(errors, fmt.Sprintf("Invalid firmware: %s", vm.Firmware))
+	}
+
+	if vm.UEFI.SecureBootEnabled {
+		if firmware != FIRMWARE_EFI {
+			errors = append(errors, "Secure boot requires EFI firmware")
+		}
+		if hw != 0 && hw < minHardwareSecureBoot {
+			errors = append(errors, fmt.Sprintf("Secure boot requires virtual hardware version %d or later, found %d", minHardwareSecureBoot, hw))
+		}
+	}
+
+	if vm.VTPM.Present {
+		errors = append(errors, vm.vtpmErrors()...)
+	}
+
+	switch strings.ToLower(vm.ManagedVM.AutoAddVTPM) {
+	case "", AUTO_ADD_VTPM_SOFTWARE:
+	default:
+		errors = append(errors, fmt.Sprintf("Invalid managedVM.autoAddVTPM: %s", vm.ManagedVM.AutoAddVTPM))
+	}
+
+	if vm.VVTDEnable && hw != 0 && hw < minHardwareVBS {
+		errors = append(errors, fmt.Sprintf("A virtual IOMMU requires virtual hardware version %d or later, found %d", minHardwareVBS, hw))
+	}
+
+	if vm.Windows.VBSEnabled {
+		if firmware != FIRMWARE_EFI || !vm.UEFI.SecureBootEnabled {
+			errors = append(errors, "Virtualization-based security requires EFI firmware with secure boot")
+		}
+		if !vm.VHVEnable {
+			errors = append(errors, "Virtualization-based security requires vhv.enable")
+		}
+		if !vm.VVTDEnable {
+			errors = append(errors, "Virtualization-based security requires vvtd.enable")
+		}
+		if hw != 0 && hw < minHardwareVBS {
+			errors = append(errors, fmt.Sprintf("Virtualization-based security requires virtual hardware version %d or later, found %d", minHardwareVBS, hw))
+		}
+	}
+
+	for _, d := range vm.BIOS.BootDevices() {
+		if !bootDeviceRe.MatchString(d) {
+			errors = append(errors, fmt.Sprintf("Invalid boot device: %s", d))
+		}
+	}
+
+	if len(errors) > 0 {
+		return &Error{errors}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFirmware(t *testing.T) {
+	vm := new(VirtualMachine)
+	err := Unmarshal([]byte(`virtualHW.version = "19"
+firmware = "efi"
+uefi.secureBoot.enabled = "TRUE"
+bios.bootDelay = "2000"
+bios.forceSetupOnce = "TRUE"
+bios.bootOrder = "cdrom,HDD"
+`), vm)
+	ok(t, err)
+	equals(t, FIRMWARE_EFI, vm.Firmware)
+	assert(t, vm.UEFI.SecureBootEnabled, "expected secure boot to be enabled")
+	equals(t, uint(2000), vm.BIOS.BootDelay)
+	assert(t, vm.BIOS.ForceSetupOnce, "expected bios.forceSetupOnce")
+	equals(t, []string{"cdrom", "hdd"}, vm.BIOS.BootDevices())
+	ok(t, vm.Validate())
+
+	vm.BIOS.SetBootDevices("hdd", "ethernet0")
+	vm.BIOS.ForceSetupOnce = false
+	data, err := Marshal(vm)
+	ok(t, err)
+	for _, entry := range []string{
+		`firmware = "efi"`,
+		`bios.bootorder = "hdd,ethernet0"`,
+		`bios.bootdelay = "2000"`,
+		`uefi.secureboot.enabled = "true"`,
+	} {
+		assert(t, strings.Contains(string(data), entry+"\n"), "expected %s in:\n%s", entry, data)
+	}
+	assert(t, !strings.Contains(string(data), "forcesetuponce"), "expected bios.forceSetupOnce to be omitted in:\n%s", data)
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		vm     VirtualMachine
+		errors int
+	}{
+		{"defaults", VirtualMachine{}, 0},
+		{"bios", VirtualMachine{Firmware: FIRMWARE_BIOS, BIOS: BIOS{BootOrder: "hdd,cdrom,floppy"}}, 0},
+		{"invalid firmware", VirtualMachine{Firmware: "coreboot"}, 1},
+		{"old efi", VirtualMachine{Firmware: FIRMWARE_EFI, Vhardware: Vhardware{Version: 7}}, 1},
+		{"secure boot without efi", VirtualMachine{UEFI: UEFI{SecureBootEnabled: true}}, 1},
+		{"old secure boot", VirtualMachine{Firmware: FIRMWARE_EFI, Vhardware: Vhardware{Version: 11}, UEFI: UEFI{SecureBootEnabled: true}}, 1},
+		{"boot device", VirtualMachine{BIOS: BIOS{BootOrder: "hdd,usb"}}, 1},
+		{"vtpm", VirtualMachine{Firmware: FIRMWARE_EFI, ManagedVM: ManagedVM{AutoAddVTPM: "software"}, VTPM: VTPM{Present: true}}, 0},
+		{"vtpm without efi or encryption", VirtualMachine{VTPM: VTPM{Present: true}}, 2},
+		{"old vtpm", VirtualMachine{Firmware: FIRMWARE_EFI, Vhardware: Vhardware{Version: 13}, ManagedVM: ManagedVM{AutoAddVTPM: "software"}, VTPM: VTPM{Present: true}}, 1},
+		{"invalid autoAddVTPM", VirtualMachine{ManagedVM: ManagedVM{AutoAddVTPM: "hardware"}}, 1},
+		{"old vvtd", VirtualMachine{Vhardware: Vhardware{Version: 13}, VVTDEnable: true}, 1},
+		{"vbs", VirtualMachine{Firmware: FIRMWARE_EFI, UEFI: UEFI{SecureBootEnabled: true}, VHVEnable: true, VVTDEnable: true, Windows: Windows{VBSEnabled: true}}, 0},
+		{"vbs without requirements", VirtualMachine{Windows: Windows{VBSEnabled: true}}, 3},
+	}
+	for _, tt := range tests {
+		err := tt.vm.Validate()
+		if tt.errors == 0 {
+			assert(t, err == nil, "%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		assert(t, err != nil, "%s: expected error", tt.name)
+		equals(t, tt.errors, len(err.(*Error).Errors))
+	}
+}
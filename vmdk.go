@@ -0,0 +1,376 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrNotDescriptor is returned when reading a VMDK file that holds disk
+// data, such as a flat extent, instead of a disk descriptor.
+var ErrNotDescriptor = errors.New("file is not a VMDK descriptor")
+
+// Magic number of hosted sparse extents, "KDMV".
+const sparseMagic = 0x564d444b
+
+// Text descriptors are small, anything bigger is disk data.
+const maxDescriptorSize = 1 << 20
+
+// DiskDescriptor describes a VMDK virtual disk: the extents holding its
+// data and, for delta disks such as snapshots and linked clones, the disk
+// it is based on.
+type DiskDescriptor struct {
+	Version    int
+	CID        string
+	ParentCID  string
+	CreateType string
+	// Path of the parent disk, relative to the descriptor
+	ParentFileNameHint string
+	Extents            []Extent
+	// Disk database, ddb.* entries
+	DDB map[string]string
+}
+
+// Extent is a region of a virtual disk stored in a file.
+type Extent struct {
+	// RW, RDONLY or NOACCESS
+	Access string
+	// Size in 512 byte sectors
+	Size int64
+	// FLAT, SPARSE, ZERO, VMFS, VMFSSPARSE...
+	Type string
+	// Path of the extent, relative to the descriptor. Empty for ZERO
+	// extents.
+	Filename string
+	// Offset, in sectors, of the extent within the file
+	Offset int64
+}
+
+// Capacity returns the size of the disk in bytes.
+func (d *DiskDescriptor) Capacity() int64 {
+	var sectors int64
+	for _, e := range d.Extents {
+		sectors += e.Size
+	}
+	return sectors * 512
+}
+
+// ParseDiskDescriptor parses a text VMDK descriptor.
+func ParseDiskDescriptor(r io.Reader) (*DiskDescriptor, error) {
+	d := &DiskDescriptor{DDB: make(map[string]string)}
+
+	var errors []string
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(strings.TrimRight(scanner.Text(), "\x00"))
+		if isBlankOrComment(line) {
+			continue
+		}
+
+		if isExtentLine(line) {
+			e, err := parseExtent(line)
+			if err != nil {
+				errors = append(errors, fmt.Sprintf("line %d: %v", lineNum, err))
+				continue
+			}
+			d.Extents = append(d.Extents, e)
+			continue
+		}
+
+		i := strings.Index(line, "=")
+		if i < 0 {
+			errors = append(errors, fmt.Sprintf("line %d: Invalid line: %s", lineNum, line))
+			continue
+		}
+
+		key := strings.TrimSpace(line[:i])
+		value := strings.Trim(strings.TrimSpace(line[i+1:]), `"`)
+		switch {
+		case strings.HasPrefix(key, "ddb."):
+			d.DDB[key] = value
+		case key == "version":
+			d.Version, _ = strconv.Atoi(value)
+		case key == "CID":
+			d.CID = value
+		case key == "parentCID":
+			d.ParentCID = value
+		case key == "createType":
+			d.CreateType = value
+		case key == "parentFileNameHint":
+			d.ParentFileNameHint = value
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(errors) > 0 {
+		return nil, &Error{errors}
+	}
+	return d, nil
+}
+
+func isExtentLine(line string) bool {
+	for _, access := range []string{"RW ", "RDONLY ", "NOACCESS "} {
+		if strings.HasPrefix(line, access) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parses extent lines such as RW 4192256 FLAT "disk-flat.vmdk" 0
+func parseExtent(line string) (Extent, error) {
+	var fields []string
+	rest := line
+	for rest != "" {
+		rest = strings.TrimLeft(rest, " \t")
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				return Extent{}, fmt.Errorf("Unterminated file name: %s", line)
+			}
+			fields = append(fields, rest[1:end+1])
+			rest = rest[end+2:]
+			continue
+		}
+		end := strings.IndexAny(rest, " \t")
+		if end < 0 {
+			end = len(rest)
+		}
+		if end > 0 {
+			fields = append(fields, rest[:end])
+		}
+		rest = rest[end:]
+	}
+
+	if len(fields) < 3 {
+		return Extent{}, fmt.Errorf("Invalid extent: %s", line)
+	}
+
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return Extent{}, fmt.Errorf("Invalid extent size: %s", line)
+	}
+
+	e := Extent{Access: fields[0], Size: size, Type: fields[2]}
+	if len(fields) > 3 {
+		e.Filename = fields[3]
+	}
+	if len(fields) > 4 {
+		if e.Offset, err = strconv.ParseInt(fields[4], 10, 64); err != nil {
+			return Extent{}, fmt.Errorf("Invalid extent offset: %s", line)
+		}
+	}
+	return e, nil
+}
+
+// ReadDiskDescriptor reads the descriptor of the VMDK file at path, which
+// can be a text descriptor or a monolithic sparse disk with an embedded
+// descriptor. It returns ErrNotDescriptor for files holding disk data.
+func ReadDiskDescriptor(path string) (*DiskDescriptor, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Sparse extent header: magic, version, flags, capacity, grain size,
+	// descriptor offset and size, in sectors.
+	header := make([]byte, 44)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	header = header[:n]
+
+	if len(header) == 44 && binary.LittleEndian.Uint32(header) == sparseMagic {
+		offset := int64(binary.LittleEndian.Uint64(header[28:]))
+		size := int64(binary.LittleEndian.Uint64(header[36:]))
+		if offset == 0 || size == 0 {
+			return nil, ErrNotDescriptor
+		}
+		return ParseDiskDescriptor(io.NewSectionReader(f, offset*512, size*512))
+	}
+
+	if !bytes.HasPrefix(header, []byte("# Disk DescriptorFile")) {
+		return nil, ErrNotDescriptor
+	}
+
+	if _, err := f.Seek(0, os.SEEK_SET); err != nil {
+		return nil, err
+	}
+	return ParseDiskDescriptor(io.LimitReader(f, maxDescriptorSize))
+}
+
+// Bytes returns the descriptor in the text format VMware writes.
+func (d *DiskDescriptor) Bytes() []byte {
+	var b bytes.Buffer
+	b.WriteString("# Disk DescriptorFile\n")
+	fmt.Fprintf(&b, "version=%d\n", d.Version)
+	if d.CID != "" {
+		fmt.Fprintf(&b, "CID=%s\n", d.CID)
+	}
+	if d.ParentCID != "" {
+		fmt.Fprintf(&b, "parentCID=%s\n", d.ParentCID)
+	}
+	if d.CreateType != "" {
+		fmt.Fprintf(&b, "createType=%q\n", d.CreateType)
+	}
+	if d.ParentFileNameHint != "" {
+		fmt.Fprintf(&b, "parentFileNameHint=%q\n", d.ParentFileNameHint)
+	}
+
+	b.WriteString("\n# Extent description\n")
+	for _, e := range d.Extents {
+		fmt.Fprintf(&b, "%s %d %s", e.Access, e.Size, e.Type)
+		if e.Filename != "" {
+			fmt.Fprintf(&b, " %q", e.Filename)
+			if e.Offset != 0 {
+				fmt.Fprintf(&b, " %d", e.Offset)
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n# The Disk Data Base\n#DDB\n\n")
+	keys := make([]string, 0, len(d.DDB))
+	for k := range d.DDB {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s = %q\n", k, d.DDB[k])
+	}
+	return b.Bytes()
+}
+
+// Layout of the sparse extents written by CreateDeltaDisk.
+const (
+	// Sectors per grain, 64 KB
+	sparseGrainSize = 128
+	// Grain table entries per grain table
+	sparseGTEs = 512
+	// Sectors reserved for the embedded descriptor
+	sparseDescriptorSize = 20
+)
+
+// CreateDeltaDisk creates at path an empty monolithic sparse disk based on
+// the disk at parent, which is referenced by its path relative to the new
+// disk when possible. Writes to the new disk leave the parent untouched,
+// as with snapshots and linked clones.
+func CreateDeltaDisk(path, parent string) error {
+	p, err := ReadDiskDescriptor(parent)
+	if err != nil {
+		return err
+	}
+
+	hint := parent
+	if abs, err := filepath.Abs(parent); err == nil {
+		hint = abs
+	}
+	if dir, err := filepath.Abs(filepath.Dir(path)); err == nil {
+		if rel, err := filepath.Rel(dir, hint); err == nil && !strings.HasPrefix(rel, "..") {
+			hint = rel
+		}
+	}
+
+	parentCID := p.CID
+	if parentCID == "" {
+		parentCID = "ffffffff"
+	}
+
+	capacity := p.Capacity() / 512
+	d := &DiskDescriptor{
+		Version:            1,
+		CID:                randomCID(),
+		ParentCID:          parentCID,
+		CreateType:         "monolithicSparse",
+		ParentFileNameHint: hint,
+		Extents:            []Extent{{Access: "RW", Size: capacity, Type: "SPARSE", Filename: filepath.Base(path)}},
+		DDB:                make(map[string]string),
+	}
+	// The geometry and adapter of the disk are those of its parent, its
+	// identity is its own.
+	for k, v := range p.DDB {
+		switch k {
+		case "ddb.uuid", "ddb.longContentID", "ddb.deletable", "ddb.thinProvisioned":
+			continue
+		}
+		d.DDB[k] = v
+	}
+
+	return writeSparseExtent(path, capacity, d.Bytes())
+}
+
+func randomCID() string {
+	var b [4]byte
+	rand.Read(b[:])
+	return fmt.Sprintf("%08x", binary.BigEndian.Uint32(b[:]))
+}
+
+// Writes an empty hosted sparse extent of capacity sectors, with an
+// embedded descriptor and preallocated, redundant, grain tables.
+func writeSparseExtent(path string, capacity int64, descriptor []byte) error {
+	if len(descriptor) > sparseDescriptorSize*512 {
+		return fmt.Errorf("descriptor too large: %d bytes", len(descriptor))
+	}
+
+	numGTs := (capacity + sparseGrainSize*sparseGTEs - 1) / (sparseGrainSize * sparseGTEs)
+	gdSectors := (numGTs*4 + 511) / 512
+	gtSectors := int64(sparseGTEs * 4 / 512)
+
+	rgdOffset := int64(1 + sparseDescriptorSize)
+	gdOffset := rgdOffset + gdSectors + numGTs*gtSectors
+	overhead := gdOffset + gdSectors + numGTs*gtSectors
+	overhead = (overhead + sparseGrainSize - 1) / sparseGrainSize * sparseGrainSize
+
+	buf := make([]byte, overhead*512)
+	header := buf[:512]
+	binary.LittleEndian.PutUint32(header[0:], sparseMagic)
+	binary.LittleEndian.PutUint32(header[4:], 1)
+	// Valid newline detection and redundant grain tables
+	binary.LittleEndian.PutUint32(header[8:], 3)
+	binary.LittleEndian.PutUint64(header[12:], uint64(capacity))
+	binary.LittleEndian.PutUint64(header[20:], sparseGrainSize)
+	binary.LittleEndian.PutUint64(header[28:], 1)
+	binary.LittleEndian.PutUint64(header[36:], sparseDescriptorSize)
+	binary.LittleEndian.PutUint32(header[44:], sparseGTEs)
+	binary.LittleEndian.PutUint64(header[48:], uint64(rgdOffset))
+	binary.LittleEndian.PutUint64(header[56:], uint64(gdOffset))
+	binary.LittleEndian.PutUint64(header[64:], uint64(overhead))
+	copy(header[73:], "\n \r\n")
+
+	copy(buf[512:], descriptor)
+
+	// Grain directories point to their grain tables, which are empty.
+	for _, gd := range []int64{rgdOffset, gdOffset} {
+		for i := int64(0); i < numGTs; i++ {
+			gt := gd + gdSectors + i*gtSectors
+			binary.LittleEndian.PutUint32(buf[gd*512+i*4:], uint32(gt))
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,117 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testDescriptor = `# Disk DescriptorFile
+version=1
+encoding="UTF-8"
+CID=a1b2c3d4
+parentCID=ffffffff
+createType="twoGbMaxExtentFlat"
+parentFileNameHint="../base/base.vmdk"
+
+# Extent description
+RW 4192256 FLAT "disk-f001.vmdk" 0
+RW 2048 FLAT "disk with spaces-f002.vmdk" 0
+RDONLY 1024 ZERO
+
+# The Disk Data Base
+#DDB
+
+ddb.adapterType = "lsilogic"
+ddb.virtualHWVersion = "14"
+`
+
+func TestParseDiskDescriptor(t *testing.T) {
+	d, err := ParseDiskDescriptor(strings.NewReader(testDescriptor))
+	ok(t, err)
+	equals(t, 1, d.Version)
+	equals(t, "a1b2c3d4", d.CID)
+	equals(t, "twoGbMaxExtentFlat", d.CreateType)
+	equals(t, "../base/base.vmdk", d.ParentFileNameHint)
+	equals(t, []Extent{
+		{Access: "RW", Size: 4192256, Type: "FLAT", Filename: "disk-f001.vmdk"},
+		{Access: "RW", Size: 2048, Type: "FLAT", Filename: "disk with spaces-f002.vmdk"},
+		{Access: "RDONLY", Size: 1024, Type: "ZERO"},
+	}, d.Extents)
+	equals(t, "lsilogic", d.DDB["ddb.adapterType"])
+	equals(t, int64((4192256+2048+1024)*512), d.Capacity())
+
+	_, err = ParseDiskDescriptor(strings.NewReader("RW many FLAT \"disk.vmdk\"\n"))
+	assert(t, err != nil, "expected error for an invalid extent size")
+}
+
+// Writes a monolithic sparse disk header followed by an embedded
+// descriptor.
+func writeSparseDisk(t *testing.T, path, descriptor string) {
+	data := make([]byte, 1024)
+	binary.LittleEndian.PutUint32(data, sparseMagic)
+	binary.LittleEndian.PutUint64(data[28:], 1)
+	binary.LittleEndian.PutUint64(data[36:], 1)
+	copy(data[512:], descriptor)
+	ok(t, ioutil.WriteFile(path, data, 0644))
+}
+
+func TestReadDiskDescriptor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govmx")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+
+	sparse := filepath.Join(dir, "sparse.vmdk")
+	writeSparseDisk(t, sparse, "# Disk DescriptorFile\nCID=0000beef\ncreateType=\"monolithicSparse\"\nRW 2048 SPARSE \"sparse.vmdk\"\n")
+	d, err := ReadDiskDescriptor(sparse)
+	ok(t, err)
+	equals(t, "monolithicSparse", d.CreateType)
+	equals(t, "sparse.vmdk", d.Extents[0].Filename)
+
+	flat := filepath.Join(dir, "disk-flat.vmdk")
+	ok(t, ioutil.WriteFile(flat, make([]byte, 4096), 0644))
+	_, err = ReadDiskDescriptor(flat)
+	equals(t, ErrNotDescriptor, err)
+}
+
+func TestCreateDeltaDisk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govmx")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+
+	parent := filepath.Join(dir, "base.vmdk")
+	ok(t, ioutil.WriteFile(parent, []byte(testDescriptor+"ddb.uuid = \"60 00 c2 9a\"\n"), 0644))
+	p, err := ReadDiskDescriptor(parent)
+	ok(t, err)
+
+	// Descriptors survive a round trip.
+	written, err := ParseDiskDescriptor(bytes.NewReader(p.Bytes()))
+	ok(t, err)
+	equals(t, p, written)
+
+	child := filepath.Join(dir, "child.vmdk")
+	ok(t, CreateDeltaDisk(child, parent))
+	assert(t, CreateDeltaDisk(child, parent) != nil, "expected error overwriting %s", child)
+
+	d, err := ReadDiskDescriptor(child)
+	ok(t, err)
+	equals(t, "monolithicSparse", d.CreateType)
+	equals(t, "base.vmdk", d.ParentFileNameHint)
+	equals(t, p.CID, d.ParentCID)
+	equals(t, p.Capacity(), d.Capacity())
+	equals(t, []Extent{{Access: "RW", Size: p.Capacity() / 512, Type: "SPARSE", Filename: "child.vmdk"}}, d.Extents)
+	equals(t, p.DDB["ddb.adapterType"], d.DDB["ddb.adapterType"])
+	_, found := d.DDB["ddb.uuid"]
+	assert(t, !found, "expected the delta disk to have its own identity")
+
+	info, err := os.Stat(child)
+	ok(t, err)
+	equals(t, int64(0), info.Size()%(sparseGrainSize*512))
+}
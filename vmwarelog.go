@@ -0,0 +1,257 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Line prefixes of the formats used by VMware products over time.
+var (
+	// 2019-03-12T10:15:30.123+01:00| vmx| I125: message
+	logLineRe = regexp.MustCompile(`^(\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d+(?:Z|[+-]\d\d:\d\d))\| ([^|]+)\| (?:([A-Z]\d{3}): )?(.*)$`)
+	// 2021-01-10T12:34:56.789Z In(05) vmx - message, as logged by ESXi 7
+	// and later
+	logLineESXRe = regexp.MustCompile(`^(\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d+(?:Z|[+-]\d\d:\d\d)) ([A-Z][a-z]\(\d+\)) (\S+)(?: -)? ?(.*)$`)
+	// Mar 12 10:15:30.123: vmx| message, as logged by older products
+	logLineOldRe = regexp.MustCompile(`^([A-Z][a-z]{2} [ \d]\d \d\d:\d\d:\d\d\.\d{3}): ([^|]+)\| (.*)$`)
+)
+
+var (
+	logProductRe = regexp.MustCompile(`^Log for (.+?) pid=\d+ version=(\S+) build=(\S+)`)
+	logHostRe    = regexp.MustCompile(`^Hostname=(\S+)`)
+	logMACRe     = regexp.MustCompile(`(?i)^(ethernet\d+) MAC Address: ([0-9a-f]{2}(?::[0-9a-f]{2}){5})`)
+	logToolsRe   = regexp.MustCompile(`toolbox: Version: ([^,\s]+)|TOOLS setting legacy tools version to '(\d+)'`)
+)
+
+// LogEntry is a message of a vmware.log file.
+type LogEntry struct {
+	// Line number of the message in the file
+	Line int
+	// Older products do not log the year, which is then 0.
+	Time time.Time
+	// Thread logging the message, such as vmx, vcpu-0 or mks
+	Thread string
+	// Level and source of the message, such as I125 or In(05). Empty for
+	// products that do not log it.
+	Level string
+	// Messages spanning several lines are joined with newlines.
+	Message string
+}
+
+// DictSection is a section of the effective configuration VMware logs
+// when powering on a VM:
+//
+//	DICT --- CONFIGURATION /home/me/vmware/core01/core01.vmx
+//	DICT            config.version = "8"
+type DictSection struct {
+	// Name of the section, such as CONFIGURATION or USER PREFERENCES
+	Name string
+	// File the settings were read from, if any
+	Path     string
+	Document *Document
+}
+
+// LogFacts are facts about a VM extracted from its vmware.log.
+type LogFacts struct {
+	// Product running the VM, such as VMware Workstation, and its version
+	Product string
+	Version string
+	Build   string
+	// Host running the VM
+	Hostname string
+	// Times the VM was powered on
+	PowerOns []time.Time
+	// MAC addresses generated for adapters, by adapter, as in ethernet0
+	GeneratedAddresses map[string]string
+	// Version of VMware Tools, as reported by the guest
+	ToolsVersion string
+	// Messages logged as errors
+	Errors []LogEntry
+}
+
+// VMwareLog is a parsed vmware.log file, the log VMware writes next to
+// the VMX file of running VMs.
+type VMwareLog struct {
+	Entries []LogEntry
+	// DICT sections, in the order they were logged
+	Dict  []*DictSection
+	Facts LogFacts
+}
+
+// ParseVMwareLog parses a vmware.log file. Lines without a known prefix
+// are taken as the continuation of the previous message.
+func ParseVMwareLog(r io.Reader) (*VMwareLog, error) {
+	log := &VMwareLog{
+		Facts: LogFacts{GeneratedAddresses: make(map[string]string)},
+	}
+
+	// Some messages, such as the guest's command line, are longer than
+	// what bufio.Scanner accepts by default, so lines are read whole.
+	reader := bufio.NewReader(r)
+	for lineNum := 1; ; lineNum++ {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF && line == "" {
+			break
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		entry, ok := parseLogLine(line)
+		if !ok {
+			if n := len(log.Entries); n > 0 {
+				log.Entries[n-1].Message += "\n" + line
+				continue
+			}
+			entry = LogEntry{Message: line}
+		}
+		entry.Line = lineNum
+		log.Entries = append(log.Entries, entry)
+	}
+
+	for _, e := range log.Entries {
+		log.extract(e)
+	}
+	return log, nil
+}
+
+// ReadVMwareLog reads the vmware.log file at path.
+func ReadVMwareLog(path string) (*VMwareLog, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseVMwareLog(f)
+}
+
+func parseLogLine(line string) (LogEntry, bool) {
+	if m := logLineRe.FindStringSubmatch(line); m != nil {
+		t, err := time.Parse("2006-01-02T15:04:05.999999999Z07:00", m[1])
+		if err == nil {
+			return LogEntry{Time: t, Thread: m[2], Level: m[3], Message: m[4]}, true
+		}
+	}
+	if m := logLineESXRe.FindStringSubmatch(line); m != nil {
+		t, err := time.Parse("2006-01-02T15:04:05.999999999Z07:00", m[1])
+		if err == nil {
+			return LogEntry{Time: t, Level: m[2], Thread: m[3], Message: m[4]}, true
+		}
+	}
+	if m := logLineOldRe.FindStringSubmatch(line); m != nil {
+		t, err := time.Parse("Jan _2 15:04:05.000", m[1])
+		if err == nil {
+			return LogEntry{Time: t, Thread: m[2], Message: m[3]}, true
+		}
+	}
+	return LogEntry{}, false
+}
+
+// Adds the DICT entries and facts found in e.
+func (l *VMwareLog) extract(e LogEntry) {
+	msg := strings.TrimSpace(e.Message)
+
+	if strings.HasPrefix(msg, "DICT ") {
+		l.extractDict(strings.TrimSpace(strings.TrimPrefix(msg, "DICT ")))
+		return
+	}
+
+	facts := &l.Facts
+	if m := logProductRe.FindStringSubmatch(msg); m != nil {
+		facts.Product, facts.Version, facts.Build = m[1], m[2], m[3]
+		facts.PowerOns = append(facts.PowerOns, e.Time)
+	}
+	if m := logHostRe.FindStringSubmatch(msg); m != nil {
+		facts.Hostname = m[1]
+	}
+	if m := logMACRe.FindStringSubmatch(msg); m != nil {
+		facts.GeneratedAddresses[strings.ToLower(m[1])] = strings.ToLower(m[2])
+	}
+	if m := logToolsRe.FindStringSubmatch(msg); m != nil {
+		facts.ToolsVersion = m[1] + m[2]
+	}
+	if strings.HasPrefix(e.Level, "E") || strings.Contains(msg, "Msg_Post: Error") {
+		facts.Errors = append(facts.Errors, e)
+	}
+}
+
+func (l *VMwareLog) extractDict(s string) {
+	if strings.HasPrefix(s, "---") {
+		// Section names are upper case, followed by the path of the file
+		// the section was read from.
+		fields := strings.Fields(strings.TrimPrefix(s, "---"))
+		n := 0
+		for n < len(fields) && fields[n] == strings.ToUpper(fields[n]) && !strings.ContainsAny(fields[n], `/\.~`) {
+			n++
+		}
+		l.Dict = append(l.Dict, &DictSection{
+			Name:     strings.Join(fields[:n], " "),
+			Path:     strings.Join(fields[n:], " "),
+			Document: new(Document),
+		})
+		return
+	}
+
+	if len(l.Dict) == 0 {
+		return
+	}
+	key, value, err := parseLine(s)
+	if err != nil {
+		return
+	}
+	section := l.Dict[len(l.Dict)-1]
+	section.Document.Set(key, value)
+
+	// Generated addresses are also logged along with the configuration.
+	if section.Name == "CONFIGURATION" {
+		if device := DeviceOf(key); strings.EqualFold(key[len(device):], ".generatedAddress") {
+			if _, found := l.Facts.GeneratedAddresses[strings.ToLower(device)]; !found {
+				l.Facts.GeneratedAddresses[strings.ToLower(device)] = strings.ToLower(value)
+			}
+		}
+	}
+}
+
+// Section returns the last DICT section with the given name, or nil.
+func (l *VMwareLog) Section(name string) *DictSection {
+	for i := len(l.Dict) - 1; i >= 0; i-- {
+		if strings.EqualFold(l.Dict[i].Name, name) {
+			return l.Dict[i]
+		}
+	}
+	return nil
+}
+
+// Config returns the VMX configuration the VM was powered on with, as
+// logged in the CONFIGURATION section, or nil. It can be compared to the
+// VMX file with Diff.
+func (l *VMwareLog) Config() *Document {
+	if s := l.Section("CONFIGURATION"); s != nil {
+		return s.Document
+	}
+	return nil
+}
+
+// FillGeneratedAddresses sets the GeneratedAddress of the Ethernet
+// adapters of vm from the addresses found in the log. It returns the
+// number of adapters updated.
+func (l *VMwareLog) FillGeneratedAddresses(vm *VirtualMachine) int {
+	n := 0
+	for i := range vm.Ethernet {
+		eth := &vm.Ethernet[i]
+		mac, found := l.Facts.GeneratedAddresses[strings.ToLower(eth.VMXID)]
+		if !found || strings.EqualFold(eth.GeneratedAddress, mac) {
+			continue
+		}
+		eth.GeneratedAddress = mac
+		n++
+	}
+	return n
+}
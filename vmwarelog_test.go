@@ -0,0 +1,114 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testVMwareLog = `2019-03-12T10:15:30.123+01:00| vmx| I125: Log for VMware Workstation pid=4242 version=15.0.2 build=build-10952284 option=Release
+2019-03-12T10:15:30.123+01:00| vmx| I125: The process is 64-bit.
+2019-03-12T10:15:30.124+01:00| vmx| I125: Hostname=builder01
+2019-03-12T10:15:30.130+01:00| vmx| I125: DICT --- USER PREFERENCES /home/me/.vmware/preferences
+2019-03-12T10:15:30.130+01:00| vmx| I125: DICT   pref.vmplayer.exit.vmAction = "poweroff"
+2019-03-12T10:15:30.131+01:00| vmx| I125: DICT --- CONFIGURATION /home/me/vmware/core01/core01.vmx
+2019-03-12T10:15:30.131+01:00| vmx| I125: DICT            config.version = "8"
+2019-03-12T10:15:30.131+01:00| vmx| I125: DICT         virtualHW.version = "16"
+2019-03-12T10:15:30.131+01:00| vmx| I125: DICT               displayName = "core01"
+2019-03-12T10:15:30.131+01:00| vmx| I125: DICT  ethernet1.generatedAddress = "00:0c:29:ab:cd:f9"
+2019-03-12T10:15:31.002+01:00| vmx| I125: Ethernet0 MAC Address: 00:0C:29:AB:CD:EF
+2019-03-12T10:15:31.500+01:00| vmx| E105: PANIC: something went wrong
+while powering on
+2019-03-12T10:16:02.871+01:00| vcpu-0| I125: Guest: toolbox: Version: 10.3.10, build-12406962
+`
+
+func TestParseVMwareLog(t *testing.T) {
+	log, err := ParseVMwareLog(strings.NewReader(testVMwareLog))
+	ok(t, err)
+	equals(t, 13, len(log.Entries))
+
+	first := log.Entries[0]
+	equals(t, 1, first.Line)
+	equals(t, "vmx", first.Thread)
+	equals(t, "I125", first.Level)
+	equals(t, time.Date(2019, 3, 12, 9, 15, 30, 123000000, time.UTC), first.Time.UTC())
+
+	failure := log.Entries[11]
+	equals(t, 12, failure.Line)
+	equals(t, "PANIC: something went wrong\nwhile powering on", failure.Message)
+
+	facts := log.Facts
+	equals(t, "VMware Workstation", facts.Product)
+	equals(t, "15.0.2", facts.Version)
+	equals(t, "build-10952284", facts.Build)
+	equals(t, "builder01", facts.Hostname)
+	equals(t, []time.Time{first.Time}, facts.PowerOns)
+	equals(t, "10.3.10", facts.ToolsVersion)
+	equals(t, map[string]string{
+		"ethernet0": "00:0c:29:ab:cd:ef",
+		"ethernet1": "00:0c:29:ab:cd:f9",
+	}, facts.GeneratedAddresses)
+	equals(t, []LogEntry{failure}, facts.Errors)
+
+	equals(t, 2, len(log.Dict))
+	prefs := log.Section("user preferences")
+	equals(t, "/home/me/.vmware/preferences", prefs.Path)
+	log.Dict = append(log.Dict, &DictSection{Name: "EXTRA", Document: new(Document)})
+	assert(t, log.Section("user preferences") == prefs, "expected the section to outlive appends")
+
+	config := log.Config()
+	displayName, _ := config.Get("displayname")
+	equals(t, "core01", displayName)
+
+	vmx, err := ParseDocument(strings.NewReader(`config.version = "8"
+virtualHW.version = "14"
+displayName = "core01"
+ethernet1.generatedAddress = "00:0c:29:ab:cd:f9"
+`))
+	ok(t, err)
+	changes := Diff(vmx, config)
+	equals(t, 1, len(changes))
+	equals(t, "16", changes[0].New)
+}
+
+func TestParseVMwareLogFormats(t *testing.T) {
+	log, err := ParseVMwareLog(strings.NewReader(`Mar 12 10:15:30.123: vmx| Log for VMware Workstation pid=4242 version=8.0.0 build=build-471780
+2021-01-10T12:34:56.789Z In(05) vmx - Log for VMware ESX pid=1234 version=7.0.1 build=build-16850804
+2021-01-10T12:34:57.001Z Er(02) vcpu-0 - Msg_Post: Error
+`))
+	ok(t, err)
+	equals(t, 3, len(log.Entries))
+
+	old := log.Entries[0]
+	equals(t, "vmx", old.Thread)
+	equals(t, "", old.Level)
+	equals(t, time.March, old.Time.Month())
+	equals(t, 12, old.Time.Day())
+
+	esx := log.Entries[1]
+	equals(t, "vmx", esx.Thread)
+	equals(t, "In(05)", esx.Level)
+	equals(t, 2021, esx.Time.Year())
+
+	equals(t, "VMware ESX", log.Facts.Product)
+	equals(t, "7.0.1", log.Facts.Version)
+	equals(t, 2, len(log.Facts.PowerOns))
+	equals(t, "vcpu-0", log.Facts.Errors[0].Thread)
+}
+
+func TestFillGeneratedAddresses(t *testing.T) {
+	log, err := ParseVMwareLog(strings.NewReader(testVMwareLog))
+	ok(t, err)
+
+	vm := &VirtualMachine{Ethernet: []Ethernet{
+		{VMXID: "ethernet0", AddressType: MAC_TYPE_GENERATED},
+		{VMXID: "ethernet1", AddressType: MAC_TYPE_GENERATED, GeneratedAddress: "00:0c:29:ab:cd:f9"},
+		{VMXID: "ethernet2", AddressType: MAC_TYPE_STATIC, Address: "00:50:56:3a:4f:01"},
+	}}
+	equals(t, 1, log.FillGeneratedAddresses(vm))
+	equals(t, "00:0c:29:ab:cd:ef", vm.Ethernet[0].GeneratedAddress)
+	equals(t, "", vm.Ethernet[2].GeneratedAddress)
+}
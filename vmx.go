@@ -40,6 +40,18 @@ func init() {
 	//log.SetFlags(log.Lshortfile)
 }
 
+// Marshaler is implemented by types that encode themselves as a single
+// VMX value.
+type Marshaler interface {
+	MarshalVMX() (string, error)
+}
+
+// Unmarshaler is implemented by types that decode themselves from a single
+// VMX value.
+type Unmarshaler interface {
+	UnmarshalVMX(value string) error
+}
+
 // Marshal traverses the value v recursively.
 // If an encountered value implements the Marshaler interface
 // and is not a nil pointer, Marshal calls its MarshalVMX method
@@ -59,29 +71,34 @@ func Unmarshal(data []byte, v interface{}) error {
 	return NewDecoder(bytes.NewReader(data), false).Decode(v)
 }
 
-// Parses struct tag
-func parseTag(tag string) (string, bool, bool, error) {
+// Parses struct tag. Besides the key, tags support the following options:
+//   - omitempty: skips the field when encoding if it has the zero value.
+//   - omit: always skips the field when encoding.
+//   - secret: replaces the value with RedactedValue when encoding with
+//     redaction enabled.
+func parseTag(tag string) (string, bool, bool, bool, error) {
 	if tag == "" {
-		return "", false, false, nil
+		return "", false, false, false, nil
 	}
 
 	omitempty := false
 	omit := false
+	secret := false
 
 	// Takes out first colon found
 	parts := strings.Split(tag, ":")
 	if len(parts) < 2 || parts[1] == "" {
-		return "", omitempty, omit, fmt.Errorf("Invalid tag: %s", tag)
+		return "", omitempty, omit, secret, fmt.Errorf("Invalid tag: %s", tag)
 	}
 
 	if parts[1] == `""` {
-		return "", omitempty, omit, fmt.Errorf("Tag name is missing: %s", tag)
+		return "", omitempty, omit, secret, fmt.Errorf("Tag name is missing: %s", tag)
 	}
 
 	// Takes out double quotes
 	parts2 := strings.Split(parts[1], `"`)
 	if len(parts2) < 2 {
-		return "", omitempty, omit, fmt.Errorf("Tag name has to be enclosed in double quotes: %s", tag)
+		return "", omitempty, omit, secret, fmt.Errorf("Tag name has to be enclosed in double quotes: %s", tag)
 	}
 
 	values := strings.Split(parts2[1], ",")
@@ -98,11 +115,13 @@ func parseTag(tag string) (string, bool, bool, error) {
 				omitempty = true
 			case "omit":
 				omit = true
+			case "secret":
+				secret = true
 			default:
-				return key, omitempty, omit, fmt.Errorf("Unknown option: %s", option)
+				return key, omitempty, omit, secret, fmt.Errorf("Unknown option: %s", option)
 			}
 		}
 	}
 
-	return key, omitempty, omit, nil
+	return key, omitempty, omit, secret, nil
 }
@@ -0,0 +1,21 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import "errors"
+
+// Omits the plaintext password when VNCKeyOnly is set. The format of
+// vnc.key is not documented, so the key can not be derived from the
+// password: it must have been set by a VMware product.
+func (r RemoteDisplay) prepareEncode() (interface{}, error) {
+	if !r.VNCKeyOnly || r.VNCPassword == "" {
+		return r, nil
+	}
+	if r.VNCKey == "" {
+		return nil, errors.New("VNCKeyOnly requires VNCKey, the key can not be derived from VNCPassword")
+	}
+
+	r.VNCPassword = ""
+	return r, nil
+}
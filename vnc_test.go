@@ -0,0 +1,28 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMarshalVNCKeyOnly(t *testing.T) {
+	vm := new(VirtualMachine)
+	vm.RemoteDisplay.VNCEnabled = true
+	vm.RemoteDisplay.VNCPassword = "password"
+	vm.RemoteDisplay.VNCKeyOnly = true
+
+	_, err := Marshal(vm)
+	assert(t, err != nil, "expected error without vnc.key")
+
+	vm.RemoteDisplay.VNCKey = "AAECAwQFBgc="
+	data, err := Marshal(vm)
+	ok(t, err)
+	assert(t, !strings.Contains(string(data), "vnc.password"), "plaintext password should not be written:\n%s", data)
+	assert(t, strings.Contains(string(data), `remotedisplay.vnc.key = "AAECAwQFBgc="`), "vnc.key should be written:\n%s", data)
+
+	// The original value is left untouched.
+	equals(t, "password", vm.RemoteDisplay.VNCPassword)
+}
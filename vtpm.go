@@ -0,0 +1,43 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EnableVTPM adds a virtual TPM to vm, as Windows 11 guests require.
+// VMware only supports vTPMs in VMs with EFI firmware whose files are
+// encrypted, either entirely or, with managedVM.autoAddVTPM set to
+// software, only the ones the vTPM needs.
+func (vm *VirtualMachine) EnableVTPM() error {
+	if errors := vm.vtpmErrors(); len(errors) > 0 {
+		return &Error{errors}
+	}
+
+	vm.VTPM.Present = true
+	return nil
+}
+
+// Returns why vm can not have a vTPM, if it can not.
+func (vm VirtualMachine) vtpmErrors() []string {
+	var errors []string
+	if !strings.EqualFold(vm.Firmware, FIRMWARE_EFI) {
+		errors = append(errors, "A vTPM requires EFI firmware")
+	}
+	if !vm.encryptedForVTPM() {
+		errors = append(errors, "A vTPM requires an encrypted VM or managedVM.autoAddVTPM set to software")
+	}
+	if hw := vm.Vhardware.Version; hw != 0 && hw < minHardwareVTPM {
+		errors = append(errors, fmt.Sprintf("A vTPM requires virtual hardware version %d or later, found %d", minHardwareVTPM, hw))
+	}
+	return errors
+}
+
+// Reports whether the files of vm, or the ones a vTPM needs, are encrypted.
+func (vm VirtualMachine) encryptedForVTPM() bool {
+	return vm.Encrypted() || vm.Encryption.KeySafe != "" ||
+		strings.EqualFold(vm.ManagedVM.AutoAddVTPM, AUTO_ADD_VTPM_SOFTWARE)
+}
@@ -0,0 +1,68 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVTPM(t *testing.T) {
+	vm := new(VirtualMachine)
+	err := Unmarshal([]byte(`virtualHW.version = "19"
+firmware = "efi"
+uefi.secureBoot.enabled = "TRUE"
+vtpm.present = "TRUE"
+managedVM.autoAddVTPM = "software"
+vhv.enable = "TRUE"
+vvtd.enable = "TRUE"
+windows.vbs.enabled = "TRUE"
+`), vm)
+	ok(t, err)
+	assert(t, vm.VTPM.Present, "expected vtpm.present")
+	equals(t, AUTO_ADD_VTPM_SOFTWARE, vm.ManagedVM.AutoAddVTPM)
+	assert(t, vm.VHVEnable, "expected vhv.enable")
+	assert(t, vm.VVTDEnable, "expected vvtd.enable")
+	assert(t, vm.Windows.VBSEnabled, "expected windows.vbs.enabled")
+	ok(t, vm.Validate())
+
+	data, err := Marshal(vm)
+	ok(t, err)
+	for _, entry := range []string{
+		`vtpm.present = "true"`,
+		`managedvm.autoaddvtpm = "software"`,
+		`vhv.enable = "true"`,
+		`vvtd.enable = "true"`,
+		`windows.vbs.enabled = "true"`,
+	} {
+		assert(t, strings.Contains(string(data), entry+"\n"), "expected %s in:\n%s", entry, data)
+	}
+}
+
+func TestEnableVTPM(t *testing.T) {
+	vm := &VirtualMachine{Vhardware: Vhardware{Version: 19}}
+	err := vm.EnableVTPM()
+	assert(t, err != nil, "expected an error without EFI firmware")
+
+	vm.Firmware = FIRMWARE_EFI
+	err = vm.EnableVTPM()
+	assert(t, err != nil, "expected an error without encryption")
+	assert(t, !vm.VTPM.Present, "expected no vTPM")
+
+	vm.Encryption.KeySafe = "vmware:key/list/()"
+	ok(t, vm.EnableVTPM())
+	assert(t, vm.VTPM.Present, "expected a vTPM")
+
+	vm = &VirtualMachine{
+		Vhardware: Vhardware{Version: 13},
+		Firmware:  FIRMWARE_EFI,
+		ManagedVM: ManagedVM{AutoAddVTPM: AUTO_ADD_VTPM_SOFTWARE},
+	}
+	err = vm.EnableVTPM()
+	assert(t, err != nil, "expected an error with virtual hardware version 13")
+
+	vm.Vhardware.Version = 14
+	ok(t, vm.EnableVTPM())
+	ok(t, vm.Validate())
+}
@@ -0,0 +1,155 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"bytes"
+	"os"
+	"time"
+)
+
+// Event is sent by Watch when a watched VMX file changes.
+type Event struct {
+	Path string
+	// Contents of the file after the change
+	Document *Document
+	// Changes from the previous contents
+	Changes Changes
+	// Set when the file could not be read or parsed. Watching continues,
+	// and the next event is relative to the last contents successfully
+	// parsed.
+	Err error
+}
+
+// WatchOptions customizes Watch.
+type WatchOptions struct {
+	// How often the file is checked for changes. Defaults to a second.
+	Interval time.Duration
+	// How long the file must remain unchanged before it is parsed, so that
+	// a burst of writes produces a single event. Defaults to 500ms.
+	Debounce time.Duration
+}
+
+// Watch polls the VMX file at path and sends an event on the returned
+// channel every time its entries change. Changes that leave every entry
+// as it was, such as reformatting the file, are not reported. The channel
+// is closed once done is closed.
+func Watch(done <-chan struct{}, path string, opts *WatchOptions) (<-chan Event, error) {
+	interval, debounce := time.Second, 500*time.Millisecond
+	if opts != nil && opts.Interval > 0 {
+		interval = opts.Interval
+	}
+	if opts != nil && opts.Debounce > 0 {
+		debounce = opts.Debounce
+	}
+
+	doc, info, err := readWatched(path)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &watcher{
+		path:     path,
+		doc:      doc,
+		modTime:  info.ModTime(),
+		size:     info.Size(),
+		debounce: debounce,
+		events:   make(chan Event),
+	}
+	go w.run(done, interval)
+	return w.events, nil
+}
+
+type watcher struct {
+	path string
+	// Last contents successfully parsed
+	doc *Document
+	// Last seen modification time and size
+	modTime time.Time
+	size    int64
+	// When the file was last seen changing, zero if it is not pending to
+	// be parsed.
+	changed  time.Time
+	debounce time.Duration
+	// Last error reported, so that it is not reported on every poll
+	lastErr string
+	events  chan Event
+}
+
+func (w *watcher) run(done <-chan struct{}, interval time.Duration) {
+	defer close(w.events)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			if e, ok := w.poll(now); ok {
+				select {
+				case w.events <- e:
+				case <-done:
+					return
+				}
+			}
+		}
+	}
+}
+
+// Checks the file, returning the event to send, if any.
+func (w *watcher) poll(now time.Time) (Event, bool) {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return w.fail(err)
+	}
+
+	if !info.ModTime().Equal(w.modTime) || info.Size() != w.size {
+		w.modTime, w.size = info.ModTime(), info.Size()
+		w.changed = now
+		return Event{}, false
+	}
+
+	if w.changed.IsZero() || now.Sub(w.changed) < w.debounce {
+		return Event{}, false
+	}
+	w.changed = time.Time{}
+
+	doc, _, err := readWatched(w.path)
+	if err != nil {
+		return w.fail(err)
+	}
+	w.lastErr = ""
+
+	changes := Diff(w.doc, doc)
+	w.doc = doc
+	if len(changes) == 0 {
+		return Event{}, false
+	}
+	return Event{Path: w.path, Document: doc, Changes: changes}, true
+}
+
+func (w *watcher) fail(err error) (Event, bool) {
+	// Retries parsing once the file changes again.
+	w.changed = time.Time{}
+	if err.Error() == w.lastErr {
+		return Event{}, false
+	}
+	w.lastErr = err.Error()
+	return Event{Path: w.path, Err: err}, true
+}
+
+func readWatched(path string) (*Document, os.FileInfo, error) {
+	data, info, err := readFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	doc, err := ParseDocument(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	return doc, info, nil
+}
@@ -0,0 +1,59 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+package vmx
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govmx")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "core01.vmx")
+	ok(t, ioutil.WriteFile(path, []byte("memsize = \"1024\"\nethernet0.present = \"TRUE\"\n"), 0644))
+
+	done := make(chan struct{})
+
+	events, err := Watch(done, path, &WatchOptions{Interval: 5 * time.Millisecond, Debounce: 20 * time.Millisecond})
+	ok(t, err)
+
+	// Modification times may not change between quick writes, so they
+	// are set explicitly.
+	write := func(contents string, mtime time.Time) {
+		ok(t, ioutil.WriteFile(path, []byte(contents), 0644))
+		ok(t, os.Chtimes(path, mtime, mtime))
+	}
+	now := time.Now()
+	write("memsize = \"2048\"\nethernet0.present = \"TRUE\"\n", now.Add(time.Second))
+	write("memsize = \"4096\"\nethernet0.present = \"TRUE\"\nethernet1.present = \"TRUE\"\n", now.Add(2*time.Second))
+
+	select {
+	case e := <-events:
+		ok(t, e.Err)
+		equals(t, Changes{
+			{Op: Modified, Key: "memsize", OldKey: "memsize", Old: "1024", New: "4096"},
+			{Op: Added, Key: "ethernet1.present", Device: "ethernet1", New: "TRUE"},
+		}, e.Changes)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+
+	write("memsize = \"4096\"\nethernet0.present = \"TRUE\"\nethernet1.present = \"TRUE\"\nbroken\n", now.Add(3*time.Second))
+	select {
+	case e := <-events:
+		assert(t, e.Err != nil, "expected a parse error")
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+
+	close(done)
+	for range events {
+	}
+}